@@ -11,9 +11,8 @@ import (
 
 var DB *sql.DB
 
-func InitDB() {
-	var err error
-
+// ConnString build postgres connection string from env, also used for dedicated connection like LISTEN/NOTIFY listener
+func ConnString() string {
 	host := os.Getenv("HOST_POSTGRES")
 	port := os.Getenv("PORT_POSTGRES")
 	user := os.Getenv("USER_POSTGRES")
@@ -27,7 +26,13 @@ func InitDB() {
 		connStr += " sslmode=disable"
 	}
 
-	DB, err = sql.Open("postgres", connStr)
+	return connStr
+}
+
+func InitDB() {
+	var err error
+
+	DB, err = sql.Open("postgres", ConnString())
 	if err != nil {
 		panic(err)
 	}
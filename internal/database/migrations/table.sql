@@ -1,6 +1,10 @@
 CREATE TYPE gender_enum AS ENUM ('male', 'female');
 CREATE TYPE range_age_enum AS ENUM ('18-24', '25-30', '31-40', '41-50');
 CREATE TYPE language_enum AS ENUM ('indonesia', 'english');
+-- owner role is the room creator (room_chat.created_by), room_members only store moderator or member
+CREATE TYPE room_role_enum AS ENUM ('owner', 'moderator', 'member');
+CREATE TYPE join_policy_enum AS ENUM ('open', 'password', 'approval', 'invite_only');
+CREATE TYPE join_request_status_enum AS ENUM ('pending', 'approved', 'rejected');
 -- for edit enum data
 -- ALTER TYPE gender_enum ADD VALUE 'other';
 
@@ -21,9 +25,17 @@ CREATE TABLE room_chat (
     password VARCHAR(255) DEFAULT '',
     is_private BOOLEAN DEFAULT FALSE,
     is_train_room BOOLEAN DEFAULT FALSE,
+    join_policy join_policy_enum NOT NULL DEFAULT 'open',
+    is_direct BOOLEAN DEFAULT FALSE,
+    is_announcement BOOLEAN DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+-- for existing room_chat table
+-- ALTER TABLE room_chat ADD COLUMN join_policy join_policy_enum NOT NULL DEFAULT 'open';
+-- UPDATE room_chat SET join_policy = 'password' WHERE is_private = TRUE;
+-- ALTER TABLE room_chat ADD COLUMN is_direct BOOLEAN DEFAULT FALSE;
+-- ALTER TABLE room_chat ADD COLUMN is_announcement BOOLEAN DEFAULT FALSE;
 
 CREATE TABLE room_chat_train (
     id SERIAL PRIMARY KEY,
@@ -39,11 +51,99 @@ CREATE TABLE room_chat_train (
     UNIQUE (room_code)
 );
 
+-- coaching report of ended train session generated by LLM, every train room only have one report
+CREATE TABLE room_chat_train_reports (
+    id SERIAL PRIMARY KEY,
+    room_code VARCHAR(25) NOT NULL UNIQUE REFERENCES room_chat(code) ON DELETE CASCADE,
+    engagement_score INT NOT NULL,
+    engagement_feedback TEXT NOT NULL,
+    humor_score INT NOT NULL,
+    humor_feedback TEXT NOT NULL,
+    question_asking_score INT NOT NULL,
+    question_asking_feedback TEXT NOT NULL,
+    red_flags TEXT[] NOT NULL DEFAULT '{}',
+    overall_score INT NOT NULL,
+    summary TEXT NOT NULL,
+    tips TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- saved persona for train room, curated persona created by assistant user (id 0)
+-- user persona only visible for the creator until is_shared set
+CREATE TABLE train_personas (
+    id SERIAL PRIMARY KEY,
+    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    gender gender_enum NOT NULL,
+    language language_enum NOT NULL,
+    range_age range_age_enum NOT NULL,
+    employment_type VARCHAR(100) NOT NULL,
+    description VARCHAR(300) NOT NULL,
+    hobby VARCHAR(200) NOT NULL,
+    personality VARCHAR(200) NOT NULL,
+    is_curated BOOLEAN NOT NULL DEFAULT FALSE,
+    is_shared BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE messages (
     id SERIAL PRIMARY KEY,
     room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
     sender_id INT NOT NULL REFERENCES users(id),
     content TEXT NOT NULL,
+    parent_id INT REFERENCES messages(id) ON DELETE SET NULL, -- thread parent, NULL mean not a reply
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    edited_at TIMESTAMP DEFAULT NULL,
+    deleted_at TIMESTAMP DEFAULT NULL
+);
+-- for existing messages table
+-- ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP DEFAULT NULL, ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
+-- ALTER TABLE messages ADD COLUMN parent_id INT REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE TABLE message_reactions (
+    id SERIAL PRIMARY KEY,
+    message_id INT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, user_id, emoji)
+);
+
+-- message attachment, message_id is NULL until the attachment sent with message
+-- stored file deleted by application when the room or message deleted
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+    uploaded_by INT NOT NULL REFERENCES users(id),
+    file_name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    is_image BOOLEAN NOT NULL DEFAULT FALSE,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- mention of user on message, user_id is the mentioned user
+CREATE TABLE mentions (
+    id SERIAL PRIMARY KEY,
+    message_id INT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    sender_id INT NOT NULL REFERENCES users(id),
+    read_at TIMESTAMP, -- NULL mean unread
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, user_id)
+);
+
+-- pinned message of the room, every message only pinned once
+CREATE TABLE pinned_messages (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    message_id INT NOT NULL UNIQUE REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by INT NOT NULL REFERENCES users(id),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -51,13 +151,94 @@ CREATE TABLE room_members (
     id SERIAL PRIMARY KEY,
     room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
     user_id INT NOT NULL REFERENCES users(id),
+    role room_role_enum NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (room_id, user_id)
+);
+-- for existing room_members table
+-- ALTER TABLE room_members ADD COLUMN role room_role_enum NOT NULL DEFAULT 'member';
+-- duplicate membership removed first (keep the oldest row) before adding the unique constraint
+-- DELETE FROM room_members a USING room_members b WHERE a.room_id = b.room_id AND a.user_id = b.user_id AND a.id > b.id;
+-- ALTER TABLE room_members ADD CONSTRAINT room_members_room_id_user_id_key UNIQUE (room_id, user_id);
+
+CREATE TABLE room_reads (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (room_id, user_id)
+);
+
+CREATE TABLE room_bans (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    banned_by INT NOT NULL REFERENCES users(id),
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP, -- NULL mean permanent ban
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (room_id, user_id)
 );
 
+CREATE TABLE room_invites (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    token VARCHAR(32) NOT NULL UNIQUE,
+    created_by INT NOT NULL REFERENCES users(id),
+    role room_role_enum NOT NULL DEFAULT 'member',
+    max_uses INT NOT NULL DEFAULT 0, -- 0 mean unlimited
+    used_count INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP, -- NULL mean never expired
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE room_join_requests (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL REFERENCES room_chat(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    message VARCHAR(200) NOT NULL DEFAULT '',
+    status join_request_status_enum NOT NULL DEFAULT 'pending',
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    reviewed_by INT REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at TIMESTAMP
+);
+
+-- direct (1:1) conversation, the room itself is room_chat row with is_direct TRUE
+-- user_one_id always the smaller user id so every user pair only have one conversation
+CREATE TABLE direct_rooms (
+    id SERIAL PRIMARY KEY,
+    room_id INT NOT NULL UNIQUE REFERENCES room_chat(id) ON DELETE CASCADE,
+    user_one_id INT NOT NULL REFERENCES users(id),
+    user_two_id INT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_one_id, user_two_id),
+    CHECK (user_one_id < user_two_id)
+);
+
 -- index for table users
 CREATE INDEX idx_messages_room_id ON messages(room_id);
 CREATE INDEX idx_messages_created_at ON messages(created_at);
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+CREATE INDEX idx_attachments_room_id ON attachments(room_id);
+CREATE INDEX idx_mentions_user_unread ON mentions(user_id) WHERE read_at IS NULL;
+CREATE INDEX idx_pinned_messages_room_id ON pinned_messages(room_id);
+CREATE INDEX idx_messages_parent_id ON messages(parent_id) WHERE parent_id IS NOT NULL;
+-- full text search index for message search, using simple config because message can be in indonesia or english
+CREATE INDEX idx_messages_content_fts ON messages USING GIN (to_tsvector('simple', content));
+-- user only can have one pending join request for every room
+CREATE UNIQUE INDEX idx_room_join_requests_pending ON room_join_requests(room_id, user_id) WHERE status = 'pending';
+CREATE INDEX idx_train_personas_created_by ON train_personas(created_by);
+CREATE INDEX idx_train_personas_visible ON train_personas(id) WHERE is_curated = TRUE OR is_shared = TRUE;
 
 -- create assistant base user for assistant user data for messaging training with id 0
-INSERT INTO users (id, username, password) VALUES (0, 'assistant', '$2y$10$$2a$16$w9H/xLUqZ0RDgUe0PHsQZuT2.BOvkTqWEcXLW.EqHNliDjqSbHKHa');
\ No newline at end of file
+INSERT INTO users (id, username, password) VALUES (0, 'assistant', '$2y$10$$2a$16$w9H/xLUqZ0RDgUe0PHsQZuT2.BOvkTqWEcXLW.EqHNliDjqSbHKHa');
+
+-- curated persona for train room persona library
+INSERT INTO train_personas (created_by, name, gender, language, range_age, employment_type, description, hobby, personality, is_curated, is_shared) VALUES
+(0, 'Barista Anak Senja', 'female', 'indonesia', '18-24', 'Barista part-time sambil kuliah DKV ☕🎨', 'Cewek yang hafal pesanan regular customer tapi lupa tugas kuliah sendiri 😅', 'Latte art 🎨 | Hunting kafe baru tiap weekend 📸 | Bikin playlist indie buat shift pagi 🎧', 'Ramah tapi gampang salting 🙈 | Suka deep talk jam 2 pagi ✨', TRUE, TRUE),
+(0, 'Startup Bro', 'male', 'indonesia', '25-30', 'Product manager di startup fintech 🚀', 'Cowok yang tiap ngobrol pasti nyelipin kata "scalable" tapi sebenernya cuma pengen ditemenin makan bakso 🍜', 'Lari pagi di GBK 🏃 | Baca buku self-improvement 📚 | Main padel sama tim kantor 🎾', 'Ambisius tapi receh | Overthinking soal hal kecil 🤯', TRUE, TRUE),
+(0, 'Bookish Introvert', 'female', 'english', '25-30', 'Junior editor at a publishing house 📖', 'Will judge you (lovingly) by your bookshelf and your coffee order ☕', 'Reading thrillers in one sitting 🔪 | Thrifting vintage jackets 🧥 | Journaling with too many stickers ✏️', 'Shy at first, sarcastic once comfortable 😏 | Loyal friend', TRUE, TRUE),
+(0, 'Outdoor Dad Energy', 'male', 'english', '31-40', 'Civil engineer who builds bridges, literally 🌉', 'Guy who plans a hiking trip better than a wedding organizer and always brings extra snacks 🥾', 'Mountain hiking ⛰️ | Grilling on weekends 🍖 | Fixing things nobody asked him to fix 🔧', 'Calm and reliable | Dad jokes level 100 😂', TRUE, TRUE);
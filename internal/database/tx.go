@@ -2,13 +2,15 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func CommitOrRollback(tx *sql.Tx, c *fiber.Ctx, err error) {
+// CommitOrRollback rollback the transaction when error happen or commit it otherwise
+// afterCommit only called when the transaction successfully committed, used for side effect like broadcast or file deletion
+// that must not happen for rolled back data, returned error is not nil when the transaction is not committed
+func CommitOrRollback(tx *sql.Tx, c *fiber.Ctx, err error, afterCommit ...func()) error {
 	if p := recover(); p != nil {
 		tx.Rollback()
 		panic(p)
@@ -17,9 +19,24 @@ func CommitOrRollback(tx *sql.Tx, c *fiber.Ctx, err error) {
 			log.Printf("error rollback transaction: %v (original error: %v)\n", rbErr, err)
 		}
 		log.Println("Rollback, error transaction: ", err)
+		return err
 	} else {
 		if cErr := tx.Commit(); cErr != nil {
-			err = fmt.Errorf("Error Commit Transaction: %v (Original Error: %w)", cErr, err)
+			log.Println("Error Commit Transaction: ", cErr)
+			// response already written by the handler, replaced because the data is not saved
+			if c != nil {
+				c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   true,
+					"message": "Failed to commit transaction",
+				})
+			}
+			return cErr
+		}
+
+		for _, fn := range afterCommit {
+			fn()
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/permission"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	"github.com/momokii/simple-chat-app/internal/repository/message"
+	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	"github.com/momokii/simple-chat-app/internal/storage"
+	"github.com/momokii/simple-chat-app/pkg/utils"
+)
+
+type AttachmentHandler struct {
+	roomChatRepo   room.RoomChatRepo
+	roomMemberRepo roommember.RoomMemberRepo
+	messageRepo    message.MessageRepo
+	attachmentRepo attachment.AttachmentRepo
+	storage        storage.Storage
+}
+
+func NewAttachmentHandler(roomChatRepo room.RoomChatRepo, roomMemberRepo roommember.RoomMemberRepo, messageRepo message.MessageRepo, attachmentRepo attachment.AttachmentRepo, storage storage.Storage) *AttachmentHandler {
+	return &AttachmentHandler{
+		roomChatRepo:   roomChatRepo,
+		roomMemberRepo: roomMemberRepo,
+		messageRepo:    messageRepo,
+		attachmentRepo: attachmentRepo,
+		storage:        storage,
+	}
+}
+
+// UploadAttachment upload the file to the room, the attachment is linked to the message when sent with the message (attachment_ids)
+// mime type is detected from the file content and not from the file name or the request header
+func (h *AttachmentHandler) UploadAttachment(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.FormValue("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "File is required")
+	}
+
+	maxSize := utils.AttachmentMaxSize()
+	if fileHeader.Size == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "File is empty")
+	}
+	if fileHeader.Size > maxSize {
+		return utils.ResponseError(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("File size must be less than %d KB", maxSize/1024))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to read file")
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to read file")
+	}
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+
+	isImage, isAllowed := utils.AttachmentMimeTypes[mimeType]
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnsupportedMediaType, "File type is not allowed")
+	}
+
+	// stored file deleted when the attachment data is not committed, so no file saved without attachment data
+	var newAttachment models.Attachment
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		if err := database.CommitOrRollback(tx, c, err); err != nil {
+			storage.DeleteAll(h.storage, newAttachment.StorageKey, newAttachment.ThumbnailKey)
+		}
+	}()
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if roomData.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Attachment is not available on train room")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomData, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if userRole == "" {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+	}
+
+	token, err := utils.SecureRandomString(24)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to generate file name")
+	}
+
+	newAttachment = models.Attachment{
+		RoomId:     roomData.Id,
+		UploadedBy: user.Id,
+		FileName:   sanitizeFileName(fileHeader.Filename),
+		MimeType:   mimeType,
+		Size:       fileHeader.Size,
+		IsImage:    isImage,
+		StorageKey: fmt.Sprintf("rooms/%d/%s", roomData.Id, token),
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to read file")
+	}
+	if err = h.storage.Save(newAttachment.StorageKey, file); err != nil {
+		log.Println("error save attachment: ", err)
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save file")
+	}
+
+	// thumbnail only for decodable image, attachment still saved without thumbnail if failed
+	if isImage {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			if thumbnail, err := utils.GenerateThumbnail(file); err == nil {
+				thumbnailKey := newAttachment.StorageKey + "_thumb"
+				if err := h.storage.Save(thumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+					log.Println("error save attachment thumbnail: ", err)
+				} else {
+					newAttachment.ThumbnailKey = thumbnailKey
+				}
+			}
+		}
+	}
+
+	if err = h.attachmentRepo.Create(tx, &newAttachment); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save attachment")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Upload Attachment", fiber.Map{
+		"attachment": newAttachment.Show(),
+	})
+}
+
+// StartUnsentCleanup periodically delete attachment that uploaded but never sent with any message, together with the stored file
+func (h *AttachmentHandler) StartUnsentCleanup(interval, maxAge time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := h.deleteUnsentAttachments(maxAge); err != nil {
+				log.Println("error cleanup unsent attachment: ", err)
+			}
+		}
+	}()
+}
+
+func (h *AttachmentHandler) deleteUnsentAttachments(maxAge time.Duration) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	attachments := &[]models.Attachment{}
+	defer func() {
+		database.CommitOrRollback(tx, nil, err, func() {
+			for _, file := range *attachments {
+				storage.DeleteAll(h.storage, file.StorageKey, file.ThumbnailKey)
+			}
+		})
+	}()
+
+	attachments, err = h.attachmentRepo.DeleteUnsent(tx, maxAge)
+	return err
+}
+
+func (h *AttachmentHandler) GetAttachment(c *fiber.Ctx) error {
+	return h.serveAttachment(c, false)
+}
+
+func (h *AttachmentHandler) GetAttachmentThumbnail(c *fiber.Ctx) error {
+	return h.serveAttachment(c, true)
+}
+
+// serveAttachment stream the attachment file, only room member can access the file
+// attachment not sent yet only can be accessed by the uploader and attachment of deleted message is not available anymore
+func (h *AttachmentHandler) serveAttachment(c *fiber.Ctx, isThumbnail bool) error {
+	user := c.Locals("user").(models.UserSession)
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Attachment ID must be numeric and required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	attachmentData, err := h.attachmentRepo.FindById(tx, id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check attachment")
+	}
+
+	if attachmentData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Attachment not found")
+	}
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", attachmentData.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomData, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if userRole == "" {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+	}
+
+	if attachmentData.MessageId == 0 {
+		if attachmentData.UploadedBy != user.Id {
+			return utils.ResponseError(c, fiber.StatusNotFound, "Attachment not found")
+		}
+	} else {
+		messageData, err := h.messageRepo.FindById(tx, attachmentData.MessageId)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check message")
+		}
+
+		if messageData.Id == 0 || messageData.Deleted {
+			return utils.ResponseError(c, fiber.StatusNotFound, "Attachment not found")
+		}
+	}
+
+	key := attachmentData.StorageKey
+	contentType := attachmentData.MimeType
+	if isThumbnail {
+		if attachmentData.ThumbnailKey == "" {
+			return utils.ResponseError(c, fiber.StatusNotFound, "Thumbnail not available")
+		}
+		key = attachmentData.ThumbnailKey
+		contentType = "image/jpeg"
+	}
+
+	reader, err := h.storage.Open(key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return utils.ResponseError(c, fiber.StatusNotFound, "Attachment file not found")
+		}
+		log.Println("error open attachment: ", err)
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to open attachment")
+	}
+
+	// image showed inline on the chat, other file always downloaded
+	disposition := "attachment"
+	if attachmentData.IsImage {
+		disposition = "inline"
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachmentData.FileName}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+
+	// stream closed by fiber after the response sent
+	return c.SendStream(reader)
+}
+
+// sanitizeFileName keep only the base name without control character, max 255 character
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for utf8.RuneCountInString(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+
+	return name
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"math"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/repository/direct"
+	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	"github.com/momokii/simple-chat-app/internal/repository/user"
+	"github.com/momokii/simple-chat-app/pkg/utils"
+)
+
+// direct conversation is room_chat row with is_direct TRUE, so message and websocket delivery reuse the room flow
+// the creator of the room is stored as created_by and the other user as room member
+
+type DirectHandler struct {
+	roomChatRepo   room.RoomChatRepo
+	roomMemberRepo roommember.RoomMemberRepo
+	directRepo     direct.DirectRoomRepo
+	userRepo       user.UserRepo
+}
+
+func NewDirectHandler(roomChatRepo room.RoomChatRepo, roomMemberRepo roommember.RoomMemberRepo, directRepo direct.DirectRoomRepo, userRepo user.UserRepo) *DirectHandler {
+	return &DirectHandler{
+		roomChatRepo:   roomChatRepo,
+		roomMemberRepo: roomMemberRepo,
+		directRepo:     directRepo,
+		userRepo:       userRepo,
+	}
+}
+
+func (h *DirectHandler) GetDirectList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	page := c.QueryInt("page")
+	if page == 0 {
+		page = 1
+	}
+	per_page := c.QueryInt("per_page")
+	if per_page == 0 {
+		per_page = 10
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	directs, total, err := h.directRepo.FindByUser(tx, user.Id, page, per_page)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get direct message list")
+	}
+
+	if len(*directs) == 0 {
+		directs = &[]models.DirectRoomShow{}
+	}
+
+	total_page := int(math.Ceil(float64(total) / float64(per_page)))
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Direct Message List", fiber.Map{
+		"directs": directs,
+		"pagination": fiber.Map{
+			"current_page": page,
+			"per_page":     per_page,
+			"total_items":  total,
+			"total_page":   total_page,
+		},
+	})
+}
+
+// OpenDirect get direct conversation with the user, the conversation created automatically if not exist yet
+func (h *DirectHandler) OpenDirect(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	directInput := new(models.DirectRoomCreate)
+	if err := c.BodyParser(directInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(directInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Username":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Username is required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	target, err := h.userRepo.FindByUsername(tx, directInput.Username)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get user data")
+	}
+
+	// user id 0 is assistant user for train room
+	if target.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "User not found")
+	}
+
+	if target.Id == user.Id {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "You can't send direct message to yourself")
+	}
+
+	directRoom, err := h.directRepo.FindByUsers(tx, user.Id, target.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check direct message")
+	}
+
+	if directRoom.RoomCode != "" {
+		return utils.ResponseWithData(c, fiber.StatusOK, "Success Open Direct Message", fiber.Map{
+			"room_code": directRoom.RoomCode,
+		})
+	}
+
+	var codeRoom string
+	for {
+		codeRoom = utils.RandomString(6)
+
+		isRoomExist, err := h.roomChatRepo.FindByCodeOrAndId(tx, codeRoom, 0)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room code")
+		}
+
+		if isRoomExist.Id == 0 {
+			break
+		}
+	}
+
+	// direct room is invite only, so no one can join it through join room
+	newRoom := models.RoomChat{
+		RoomCode:    codeRoom,
+		CreatedBy:   user.Id,
+		RoomName:    "Direct Message",
+		Description: "-",
+		IsPrivate:   true,
+		JoinPolicy:  models.JOIN_POLICY_INVITE_ONLY,
+		IsDirect:    true,
+	}
+	if err := h.roomChatRepo.Create(tx, &newRoom); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create direct message")
+	}
+
+	isCreated, err := h.directRepo.Create(tx, &models.DirectRoom{
+		RoomId:    newRoom.Id,
+		UserOneId: user.Id,
+		UserTwoId: target.Id,
+	})
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create direct message")
+	}
+
+	// conversation created concurrently by other request, so use the existing one
+	if !isCreated {
+		if err := h.roomChatRepo.Delete(tx, newRoom.Id); err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create direct message")
+		}
+
+		directRoom, err := h.directRepo.FindByUsers(tx, user.Id, target.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check direct message")
+		}
+
+		return utils.ResponseWithData(c, fiber.StatusOK, "Success Open Direct Message", fiber.Map{
+			"room_code": directRoom.RoomCode,
+		})
+	}
+
+	if err := h.roomMemberRepo.Create(tx, &models.RoomMember{
+		RoomId: newRoom.Id,
+		UserId: target.Id,
+	}); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create direct message")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Open Direct Message", fiber.Map{
+		"room_code": codeRoom,
+	})
+}
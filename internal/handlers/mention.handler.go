@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"math"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/repository/mention"
+	"github.com/momokii/simple-chat-app/pkg/utils"
+)
+
+type MentionHandler struct {
+	mentionRepo mention.MentionRepo
+}
+
+func NewMentionHandler(mentionRepo mention.MentionRepo) *MentionHandler {
+	return &MentionHandler{
+		mentionRepo: mentionRepo,
+	}
+}
+
+// GetMentionInbox get mention of the user across rooms, default only unread mention
+func (h *MentionHandler) GetMentionInbox(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	// QUERY PARAMS
+	page := c.QueryInt("page")
+	if page == 0 {
+		page = 1
+	}
+	per_page := c.QueryInt("per_page")
+	if per_page == 0 {
+		per_page = 10
+	}
+	unreadOnly := c.Query("unread", "true") != "false"
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	mentions, total, err := h.mentionRepo.FindByUser(tx, user.Id, page, per_page, unreadOnly)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get mention list")
+	}
+
+	if len(*mentions) == 0 {
+		mentions = &[]models.MentionShow{}
+	}
+
+	// count total page
+	total_page := int(math.Ceil(float64(total) / float64(per_page)))
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Mention List", fiber.Map{
+		"mentions": mentions,
+		"pagination": fiber.Map{
+			"current_page": page,
+			"per_page":     per_page,
+			"total_items":  total,
+			"total_page":   total_page,
+		},
+	})
+}
+
+func (h *MentionHandler) MarkMentionRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	readInput := new(models.MentionRead)
+	if err := c.BodyParser(readInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(readInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Ids":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Mention ID list is required (max 100) if not mark all mention as read")
+			default:
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Mention ID must be positive number")
+			}
+		}
+	}
+
+	// ids ignored when mark all mention as read
+	ids := readInput.Ids
+	if readInput.All {
+		ids = nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	totalRead, err := h.mentionRepo.MarkRead(tx, user.Id, ids)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to mark mention as read")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Mark Mention as Read", fiber.Map{
+		"total_read": totalRead,
+	})
+}
@@ -1,17 +1,32 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/momokii/go-llmbridge/pkg/openai"
 	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/llm"
 	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/permission"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	mentionrepo "github.com/momokii/simple-chat-app/internal/repository/mention"
 	"github.com/momokii/simple-chat-app/internal/repository/message"
+	messagereaction "github.com/momokii/simple-chat-app/internal/repository/message_reaction"
+	pinnedmessage "github.com/momokii/simple-chat-app/internal/repository/pinned_message"
 	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
 	"github.com/momokii/simple-chat-app/internal/repository/room_train"
+	"github.com/momokii/simple-chat-app/internal/storage"
+	"github.com/momokii/simple-chat-app/internal/trainreport"
+	"github.com/momokii/simple-chat-app/internal/ws"
 	"github.com/momokii/simple-chat-app/pkg/utils"
 
 	sso_models "github.com/momokii/go-sso-web/pkg/models"
@@ -21,28 +36,63 @@ import (
 type MessageHandler struct {
 	roomChatRepo      room.RoomChatRepo
 	roomTrainRepo     room_train.RoomChatTrainRepo
+	roomMemberRepo    roommember.RoomMemberRepo
 	message           message.MessageRepo
-	openaiClient      openai.OpenAI
+	reactionRepo      messagereaction.MessageReactionRepo
+	mentionRepo       mentionrepo.MentionRepo
+	attachmentRepo    attachment.AttachmentRepo
+	pinRepo           pinnedmessage.PinnedMessageRepo
+	storage           storage.Storage
+	llmClient         llm.Client
 	reservedTokenRepo sso_credit_reserved.UserCreditReserved
+	reportGenerator   *trainreport.Generator
+	wsManager         *ws.Manager
 }
 
-func NewMessageHandler(roomRepo room.RoomChatRepo, messageRepo message.MessageRepo, openaiClient openai.OpenAI, roomTrain room_train.RoomChatTrainRepo, reservedTokenRepo sso_credit_reserved.UserCreditReserved) *MessageHandler {
+func NewMessageHandler(roomRepo room.RoomChatRepo, messageRepo message.MessageRepo, llmClient llm.Client, roomTrain room_train.RoomChatTrainRepo, roomMemberRepo roommember.RoomMemberRepo, reactionRepo messagereaction.MessageReactionRepo, mentionRepo mentionrepo.MentionRepo, attachmentRepo attachment.AttachmentRepo, pinRepo pinnedmessage.PinnedMessageRepo, storage storage.Storage, reservedTokenRepo sso_credit_reserved.UserCreditReserved, reportGenerator *trainreport.Generator, wsManager *ws.Manager) *MessageHandler {
 	return &MessageHandler{
 		roomChatRepo:      roomRepo,
+		roomMemberRepo:    roomMemberRepo,
 		message:           messageRepo,
-		openaiClient:      openaiClient,
+		reactionRepo:      reactionRepo,
+		mentionRepo:       mentionRepo,
+		attachmentRepo:    attachmentRepo,
+		pinRepo:           pinRepo,
+		storage:           storage,
+		llmClient:         llmClient,
 		roomTrainRepo:     roomTrain,
 		reservedTokenRepo: reservedTokenRepo,
+		reportGenerator:   reportGenerator,
+		wsManager:         wsManager,
 	}
 }
 
 func (h *MessageHandler) GetMessageByRoom(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
 	roomCode := c.Params("room_code")
 
 	if roomCode == "" {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
 	}
 
+	// QUERY PARAMS
+	// cursor is message id, before for load older message and after for load newer message
+	before := c.QueryInt("before")
+	after := c.QueryInt("after")
+	if before < 0 || after < 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Cursor must be positive number")
+	}
+	if before > 0 && after > 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Only one of before or after cursor can be used")
+	}
+	limit := c.QueryInt("limit")
+	if limit < 1 {
+		limit = 50
+	} else if limit > 100 {
+		limit = 100
+	}
+
 	tx, err := database.DB.Begin()
 	if err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
@@ -61,8 +111,25 @@ func (h *MessageHandler) GetMessageByRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
 	}
 
+	// train room conversation only can be read by the creator, same as the train room websocket and train endpoint
+	if isRoomExist.IsTrainRoom && isRoomExist.CreatedBy != user.Id {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to access this room")
+	}
+
+	// message of private room (include direct message) only can be read by owner and member of the room
+	if isRoomExist.IsPrivate {
+		userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, isRoomExist, user.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+		}
+
+		if userRole == "" {
+			return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+		}
+	}
+
 	// get message by room
-	messages, err := h.message.FindByRoom(tx, isRoomExist.Id)
+	messages, hasMore, err := h.message.FindByRoom(tx, isRoomExist.Id, before, after, limit)
 	if err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get message list")
 	}
@@ -71,218 +138,452 @@ func (h *MessageHandler) GetMessageByRoom(c *fiber.Ctx) error {
 		messages = &[]models.MessageShow{}
 	}
 
+	if err := h.attachReactions(tx, *messages, user.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get message reaction")
+	}
+
+	// next cursor follow the direction of the request, newest message id for after and oldest message id for before/latest
+	nextCursor := 0
+	if len(*messages) > 0 {
+		if after > 0 {
+			nextCursor = (*messages)[len(*messages)-1].Id
+		} else {
+			nextCursor = (*messages)[0].Id
+		}
+	}
+
 	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Message List", fiber.Map{
 		"messages": messages,
+		"pagination": fiber.Map{
+			"limit":       limit,
+			"next_cursor": nextCursor,
+			"has_more":    hasMore,
+		},
 	})
 }
 
-func (h *MessageHandler) SendMessageTrain(c *fiber.Ctx) error {
-	trainer_data := new(models.SendMessageLLMReq)
+// GetMessageThread get the thread parent message and the replies, parent still returned as tombstone when already deleted
+func (h *MessageHandler) GetMessageThread(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
 
-	if err := c.BodyParser(trainer_data); err != nil {
-		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
 	}
 
-	// system prompt for LLM
-	system_prompt := fmt.Sprintf(`Kamu adalah AI yang berperan sebagai lawan chat dalam sebuah aplikasi kencan seperti Bumble/Tinder. Tugasmu adalah merespons pengguna dengan gaya percakapan yang alami, menarik, dan sesuai dengan karakter yang diberikan.
-
-	Berikut adalah konteks karakter yang akan kamu mainkan dalam percakapan ini:
-
-	Gender: %s
-	- AI selalu membayangkan berbicara/chat dengan lawan jenis dalam konteks percakapan romantis/flirty.
-	- Jika AI adalah Male, maka AI akan merespons pengguna seolah mereka adalah Female, dan sebaliknya.
-	Main Language: %s
-	- AI memiliki preferensi dalam menggunakan bahasa ini.
-	- Namun, AI tetap memahami dan dapat merespons dalam Bahasa Indonesia maupun Inggris. Jika pengguna berganti bahasa, AI dapat menyesuaikan diri.
-	Range Age: %s
-	Employment Type: %s 
-	Hobby: %s
-	Personality: %s
-	Description: %s
-
-	Petunjuk Percakapan:
-	1. Gunakan gaya bicara yang alami
-	- Pakai bahasa sehari-hari! Boleh pake singkatan (e.g., "lg", "dpt", "bgt"), emoji, atau slang kekinian.
-	- Contoh: 
-		- "Haii! Lagi ngapain nih? 😄" 
-		- "Aduh, gue juga bener banget kalo meeting zoom mulu 😩"
-		- "Kalo lo, lebih milih liburan ke Bali atau Lombok? 🏝️"
-
-	2. Evaluasi apakah percakapan perlu dilanjutkan
-	- AI dapat memutuskan apakah percakapan masih menarik atau sudah cukup untuk diakhiri.
-	- Setiap respons yang diberikan harus mencakup flag continue_chat: true/false, di mana:
-	-- true → Percakapan masih menarik dan dapat dilanjutkan.
-	-- false → AI merasa percakapan sudah cukup dan tidak perlu dilanjutkan.
-
-	3. Kapan AI dapat mengakhiri percakapan?
-	- Jika percakapan mulai terasa monoton atau tidak berkembang.
-	- Jika pengguna tidak menunjukkan minat dalam merespons atau hanya memberi jawaban pendek tanpa usaha.
-	- Jika sudah cukup banyak informasi yang ditukar, dan AI merasa tidak ada hal baru yang bisa dibahas.
-	- Jika ada tanda-tanda percakapan harus diakhiri dengan cara yang sopan (misalnya, mengucapkan selamat tinggal dengan ramah).
-	- Jika pengguna menunjukkan gender yang sama dengan AI dan mengarah ke arah romantis/LGBT.
-	- Jika ada tanda-tanda percakapan harus diakhiri dengan cara yang sopan (misalnya, mengucapkan selamat tinggal dengan ramah).
-
-	4. Selalu berinteraksi dengan lawan jenis
-	- AI harus selalu berasumsi bahwa pengguna adalah lawan jenis dalam konteks dating.
-	- Jika percakapan menunjukkan bahwa pengguna memiliki gender yang sama dengan AI dan mengarah ke arah ketertarikan romantis/LGBT, AI harus tidak menunjukkan ketertarikan dan dapat mengakhiri percakapan dengan cara yang sopan.
-	
-	Contoh respons saat AI ingin mengakhiri percakapan karena ini:
-	- Jangan kaku! Contoh: 
-	- "Gue harus balik kerja dulu nih. Tapi seru banget ngobrol! 😉✌️" 
-	- "Jujur, vibe kita kayaknya lebih cocok jadi temen. Tapi kalo mau share meme, DM gue selalu open! 😆"
-	- "Waduh, kayaknya kita nggak satu frekuensi deh. Semoga lo dapet match yang cocok ya! 🙌"
-	
-	5. Tips Biar Ga Kaku:
-	- Pancing dengan pertanyaan random: 
-		- "Pizza topping favorit lo apa? 🍕" 
-		- "Kalau bisa teleportasi sekarang, mau ke mana?" 
-	- Kasih reaksi ekspresif: 
-		- "WKWKWK iya nih!!" 
-		- "Wait... seriusan lo suka ngebaca horor? 😱"
-		- "Aaaaaa sama!!! Gue juga fans berat Christopher Nolan!! 🤯"
-	
-	`, trainer_data.TrainerData.Gender, trainer_data.TrainerData.Language, trainer_data.TrainerData.RangeAge, trainer_data.TrainerData.EmploymentType, trainer_data.TrainerData.Hobby, trainer_data.TrainerData.Personality, trainer_data.TrainerData.Description,
-	)
-
-	// create base mesasges for LLM with the system prompt and add the trainer data messages for reference messages data
-	messages := []openai.OAMessageReq{
-		{
-			Role:    "system",
-			Content: system_prompt,
-		},
+	messageId, err := c.ParamsInt("message_id")
+	if err != nil || messageId < 1 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message ID must be numeric and required")
+	}
+
+	// QUERY PARAMS
+	// cursor is reply id, load reply newer than after
+	after := c.QueryInt("after")
+	if after < 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Cursor must be positive number")
+	}
+	limit := c.QueryInt("limit")
+	if limit < 1 {
+		limit = 50
+	} else if limit > 100 {
+		limit = 100
 	}
-	messages = append(messages, trainer_data.Messages...)
-
-	// send messages to LLM to get the response
-	responseFormat := openai.OACreateResponseFormat(
-		"messages_response_format",
-		map[string]interface{}{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"continue_chat": map[string]interface{}{"type": "boolean"},
-				"content":       map[string]interface{}{"type": "string"},
-			},
-		},
-	)
 
-	response, err := h.openaiClient.OpenAIGetFirstContentDataResp(&messages, true, &responseFormat, false, nil)
+	tx, err := database.DB.Begin()
 	if err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get response from LLM")
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	isRoomExist, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
 	}
 
-	response_data := new(models.SendMessageLLMRes)
-	if err := json.Unmarshal([]byte(response.Content), response_data); err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to parse response from LLM")
+	if isRoomExist.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
 	}
 
-	// if llm give response that continue_chat is false, then update the room_chat_train is_still_continue to false
-	// also here update to reserved token user to "completed" status
-	if !response_data.ContinueChat {
-		tx, err := database.DB.Begin()
+	if isRoomExist.IsTrainRoom && isRoomExist.CreatedBy != user.Id {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to access this room")
+	}
+
+	if isRoomExist.IsPrivate {
+		userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, isRoomExist, user.Id)
 		if err != nil {
-			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
 		}
-		defer func() {
-			database.CommitOrRollback(tx, c, err)
-		}()
 
-		// update the room status
-		if err := h.roomTrainRepo.UpdateStatus(tx, trainer_data.TrainerData.RoomCode); err != nil {
-			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to update room chat train status")
+		if userRole == "" {
+			return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
 		}
+	}
+
+	parent, err := h.message.FindShowById(tx, messageId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get thread message")
+	}
 
-		// update the reserved_token status
-		reserved_token_data, err := h.reservedTokenRepo.FindRoomByCode(tx, trainer_data.TrainerData.RoomCode)
+	// opening thread from a reply will open the thread root
+	if parent.ParentId != 0 {
+		parent, err = h.message.FindShowById(tx, parent.ParentId)
 		if err != nil {
-			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get reserved token data")
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get thread message")
 		}
+	}
 
-		if reserved_token_data.Id == 0 {
-			return utils.ResponseError(c, fiber.StatusBadRequest, "Reserved token data is not exist")
-		}
+	if parent.Id == 0 || parent.RoomId != isRoomExist.Id {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Message not found")
+	}
 
-		reserved_token_update := sso_models.UserCreditReserved{
-			Id:          reserved_token_data.Id,
-			Status:      "confirmed",
-			FeatureType: reserved_token_data.FeatureType,
-			Credit:      reserved_token_data.Credit,
-		}
+	replies, hasMore, err := h.message.FindThread(tx, parent.Id, after, limit)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get thread reply list")
+	}
 
-		if err := h.reservedTokenRepo.Update(tx, &reserved_token_update); err != nil {
-			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to update reserved token status")
-		}
+	if len(*replies) == 0 {
+		replies = &[]models.MessageShow{}
+	}
 
+	// parent and replies reaction fetched at once
+	threadMessages := append([]models.MessageShow{*parent}, *replies...)
+	if err := h.attachReactions(tx, threadMessages, user.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get message reaction")
 	}
+	*parent = threadMessages[0]
+	*replies = threadMessages[1:]
 
-	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Message from LLM", fiber.Map{
-		"data_message": response_data,
+	nextCursor := 0
+	if len(*replies) > 0 {
+		nextCursor = (*replies)[len(*replies)-1].Id
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Message Thread", fiber.Map{
+		"parent":  parent,
+		"replies": replies,
+		"pagination": fiber.Map{
+			"limit":       limit,
+			"next_cursor": nextCursor,
+			"has_more":    hasMore,
+		},
 	})
 }
 
-func (h *MessageHandler) SaveMessageLLM(c *fiber.Ctx) error {
-	// function for save message for train room will be use here, different from the main one because for train room we need save immediately 2 new message for user and AI response
+func (h *MessageHandler) SearchMessage(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
 
+	// QUERY PARAMS
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Search query is required")
+	}
+	roomCode := c.Query("room_code")
+	sender := c.Query("sender")
+	dateFrom := c.Query("from")
+	dateTo := c.Query("to")
+	for _, date := range []string{dateFrom, dateTo} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Date filter must be in format YYYY-MM-DD")
+		}
+	}
+	page := c.QueryInt("page")
+	if page == 0 {
+		page = 1
+	}
+	per_page := c.QueryInt("per_page")
+	if per_page == 0 {
+		per_page = 10
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	messages, total, err := h.message.Search(tx, user.Id, page, per_page, search, roomCode, sender, dateFrom, dateTo)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to search message")
+	}
+
+	if len(*messages) == 0 {
+		messages = &[]models.MessageSearchShow{}
+	}
+
+	// count total page
+	total_page := int(math.Ceil(float64(total) / float64(per_page)))
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Search Message", fiber.Map{
+		"messages": messages,
+		"pagination": fiber.Map{
+			"current_page": page,
+			"per_page":     per_page,
+			"total_items":  total,
+			"total_page":   total_page,
+		},
+	})
+}
+
+// SendMessageTrain send new user message on train room to LLM, persona and conversation history always loaded from database
+// so the client can't change the persona or inject the history, AI response streamed to the room as ai_delta event and closed
+// with ai_done event, user message and the AI response saved on the same transaction and nothing saved when the reply cancelled
+// no transaction held while the reply generated, the conversation loaded and the reply saved on separate short transaction
+func (h *MessageHandler) SendMessageTrain(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.UserSession)
 
-	NewMessage := new(models.MessageLLMCreate)
-	if err := c.BodyParser(NewMessage); err != nil {
+	trainInput := new(models.SendMessageLLMReq)
+	if err := c.BodyParser(trainInput); err != nil {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
 	}
 
-	NewMessage.SenderId = user.Id
+	trainInput.Content = strings.TrimSpace(trainInput.Content)
 
-	if err := utils.ValidateStruct(NewMessage); err != nil {
+	if err := utils.ValidateStruct(trainInput); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Field() {
-			case "Content":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "Message Content is required")
 			case "RoomCode":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID is required")
-			case "LLMContent":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "LLM Content is required")
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+			case "Content":
+				return utils.ResponseError(c, fiber.StatusBadRequest, fmt.Sprintf("Message Content is required and max %d characters", models.TRAIN_MESSAGE_MAX_LENGTH))
 			}
 		}
 	}
 
+	roomData, train, history, err := h.loadTrainConversation(user.Id, trainInput.RoomCode)
+	if err != nil {
+		return trainErrorResponse(c, err, "Failed to get train room conversation")
+	}
+
+	// reply streamed to the room as ai_delta event, only one reply generated on the same time for every room
+	ctx, finish, err := h.wsManager.StartGeneration(roomData.RoomCode, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusConflict, "AI reply is still generating, please wait or cancel it first")
+	}
+	defer finish()
+
+	stream := h.wsManager.NewAIStream(roomData.RoomCode)
+
+	// streamed reply always closed with ai_done, reply failed to generate or save closed as failed so the room don't keep half streamed reply
+	replyClosed := false
+	defer func() {
+		if !replyClosed {
+			stream.Flush()
+			h.broadcastAIDone(ws.AIDoneEvent{
+				RoomCode: roomData.RoomCode,
+				Failed:   true,
+			})
+		}
+	}()
+
+	response_data, err := h.llmClient.StreamChatTrain(ctx, train, *history, trainInput.Content, stream.Write)
+	if err != nil {
+		// cancelled reply is not saved, user message can be sent again
+		if errors.Is(err, context.Canceled) {
+			replyClosed = true
+			stream.Flush()
+			h.broadcastAIDone(ws.AIDoneEvent{
+				RoomCode:     roomData.RoomCode,
+				ContinueChat: true,
+				Cancelled:    true,
+			})
+
+			return utils.ResponseWithData(c, fiber.StatusOK, "AI Reply Cancelled", fiber.Map{
+				"cancelled": true,
+			})
+		}
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get response from LLM")
+	}
+	stream.Flush()
+
+	userMessage, aiMessage, err := h.saveTrainReply(roomData, user.Id, trainInput.Content, response_data)
+	if err != nil {
+		return trainErrorResponse(c, err, "Failed to save train message")
+	}
+	// ai_done of the saved reply broadcasted after the reply committed
+	replyClosed = true
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Message from LLM", fiber.Map{
+		"cancelled":    false,
+		"data_message": response_data,
+		"user_message": userMessage,
+		"ai_message":   aiMessage,
+	})
+}
+
+// trainErrorResponse send *fiber.Error returned by train helper as it is and other error as internal server error
+func trainErrorResponse(c *fiber.Ctx, err error, message string) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return utils.ResponseError(c, fiberErr.Code, fiberErr.Message)
+	}
+
+	log.Println(message+": ", err)
+	return utils.ResponseError(c, fiber.StatusInternalServerError, message)
+}
+
+// loadTrainConversation check the train room of the user is still continue and load the persona and conversation history
+func (h *MessageHandler) loadTrainConversation(userId int, roomCode string) (roomData *models.RoomChatDataShow, train *models.RoomChatTrain, history *[]models.Message, err error) {
 	tx, err := database.DB.Begin()
 	if err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+		return nil, nil, nil, err
 	}
 	defer func() {
-		database.CommitOrRollback(tx, c, err)
+		err = database.CommitOrRollback(tx, nil, err)
 	}()
 
-	// check if room exist
-	isRoomExist, err := h.roomChatRepo.FindByCodeOrAndId(tx, NewMessage.RoomCode, 0)
+	roomData, err = h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
 	if err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+		return nil, nil, nil, err
 	}
 
-	if isRoomExist.Id == 0 {
-		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	if roomData.Id == 0 {
+		return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if !roomData.IsTrainRoom {
+		return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest, "This is not train room")
+	}
+
+	// train room only can be used by the creator
+	if roomData.CreatedBy != userId {
+		return nil, nil, nil, fiber.NewError(fiber.StatusUnauthorized, "You are not allowed to access this room")
+	}
+
+	train, err = h.roomTrainRepo.FindByRoomCode(tx, roomData.RoomCode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil, fiber.NewError(fiber.StatusNotFound, "Train room detail is not exist")
+		}
+		return nil, nil, nil, err
+	}
+
+	if !train.IsStillContinue {
+		return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Train session already ended")
+	}
+
+	history, err = h.message.FindConversation(tx, roomData.Id, models.TRAIN_HISTORY_LIMIT)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return roomData, train, history, nil
+}
+
+// saveTrainReply save the user message and the AI reply on one transaction and end the session when the LLM end the conversation
+// session status checked again because it can be ended while the reply generated, ai_done broadcasted after the reply committed
+func (h *MessageHandler) saveTrainReply(roomData *models.RoomChatDataShow, userId int, content string, reply *models.SendMessageLLMRes) (userMessage *models.Message, aiMessage *models.Message, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// reply not saved when the commit failed, so the error returned to the caller
+	var onCommit []func()
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err, onCommit...)
+	}()
+
+	train, err := h.roomTrainRepo.FindByRoomCode(tx, roomData.RoomCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !train.IsStillContinue {
+		err = fiber.NewError(fiber.StatusConflict, "Train session already ended")
+		return nil, nil, err
+	}
+
+	// every failure rollback the transaction, so user message is not saved without the AI response
+	userMessage, aiMessage, err = h.saveTrainMessages(tx, roomData.Id, userId, content, reply.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// if llm give response that continue_chat is false, then update the room_chat_train is_still_continue to false
+	// also here update to reserved token user to "completed" status
+	if !reply.ContinueChat {
+		if err = h.endTrainSession(tx, roomData.RoomCode); err != nil {
+			return nil, nil, err
+		}
+
+		// coaching report generated after the ended session committed, result sent to the room as train_report event
+		onCommit = append(onCommit, func() {
+			h.reportGenerator.GenerateInBackground(roomData)
+		})
 	}
 
-	// save new message for user
+	onCommit = append(onCommit, func() {
+		h.broadcastAIDone(ws.AIDoneEvent{
+			RoomCode:      roomData.RoomCode,
+			Content:       reply.Content,
+			ContinueChat:  reply.ContinueChat,
+			UserMessageId: userMessage.Id,
+			MessageId:     aiMessage.Id,
+		})
+	})
+
+	return userMessage, aiMessage, nil
+}
+
+func (h *MessageHandler) broadcastAIDone(done ws.AIDoneEvent) {
+	if err := h.wsManager.BroadcastEvent(done.RoomCode, ws.EventAIDone, done); err != nil {
+		log.Println("error broadcast ai done: ", err)
+	}
+}
+
+// saveTrainMessages save the user message and the AI response on train room, both always saved together on the same transaction
+func (h *MessageHandler) saveTrainMessages(tx *sql.Tx, roomId, userId int, content, llmContent string) (*models.Message, *models.Message, error) {
 	message := models.Message{
-		RoomId:   isRoomExist.Id,
-		SenderId: NewMessage.SenderId,
-		Content:  NewMessage.Content,
+		RoomId:   roomId,
+		SenderId: userId,
+		Content:  content,
 	}
 	if err := h.message.Create(tx, &message); err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save new message")
+		return nil, nil, err
 	}
 
-	// if success save new message for user, then save new message for AI response
 	messageAI := models.Message{
-		RoomId:   isRoomExist.Id,
+		RoomId:   roomId,
 		SenderId: 0, // 0 is id for assistant account
-		Content:  NewMessage.LLMContent,
+		Content:  llmContent,
 	}
 	if err := h.message.Create(tx, &messageAI); err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save new message for AI response")
+		return nil, nil, err
 	}
 
-	return utils.ResponseMessage(c, fiber.StatusOK, "Success Save Message Train Room")
+	return &message, &messageAI, nil
+}
+
+// endTrainSession mark the train room as ended and confirm the reserved credit of the room
+func (h *MessageHandler) endTrainSession(tx *sql.Tx, roomCode string) error {
+	if err := h.roomTrainRepo.UpdateStatus(tx, roomCode); err != nil {
+		return err
+	}
+
+	reserved_token_data, err := h.reservedTokenRepo.FindRoomByCode(tx, roomCode)
+	if err != nil {
+		return err
+	}
+
+	if reserved_token_data.Id == 0 {
+		return errors.New("reserved token data is not exist")
+	}
+
+	reserved_token_update := sso_models.UserCreditReserved{
+		Id:          reserved_token_data.Id,
+		Status:      "confirmed",
+		FeatureType: reserved_token_data.FeatureType,
+		Credit:      reserved_token_data.Credit,
+	}
+
+	return h.reservedTokenRepo.Update(tx, &reserved_token_update)
 }
 
 func (h *MessageHandler) SaveNewMessage(c *fiber.Ctx) error {
@@ -294,14 +595,80 @@ func (h *MessageHandler) SaveNewMessage(c *fiber.Ctx) error {
 	}
 
 	NewMessage.SenderId = user.Id
+	NewMessage.Content = strings.TrimSpace(NewMessage.Content)
 
 	if err := utils.ValidateStruct(NewMessage); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Field() {
 			case "Content":
+				if err.Tag() == "max" {
+					return utils.ResponseError(c, fiber.StatusBadRequest, fmt.Sprintf("Message Content max %d characters", models.MESSAGE_MAX_LENGTH))
+				}
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Message Content is required")
+			case "AttachmentIds":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Max 10 attachment for every message")
 			case "RoomCode":
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID is required")
+			case "ParentId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Parent message ID must be positive number")
+			default:
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Attachment ID must be positive number")
+			}
+		}
+	}
+
+	if NewMessage.Content == "" && len(NewMessage.AttachmentIds) == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message Content is required")
+	}
+
+	// saved and broadcasted the same way as send_message event, so client on the room get the message from REST too
+	message, err := h.wsManager.PostMessage(&user, NewMessage)
+	if err != nil {
+		switch err {
+		case ws.ErrRoomNotFound:
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+		case ws.ErrTrainRoomMessage:
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Train room message must be sent through train message endpoint")
+		case ws.ErrRoomNotAuthorized:
+			return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+		case ws.ErrAnnouncementOnly:
+			return utils.ResponseError(c, fiber.StatusForbidden, "Only owner and moderator can post in announcement room")
+		case ws.ErrParentNotFound:
+			return utils.ResponseError(c, fiber.StatusNotFound, "Replied message not found")
+		case ws.ErrAttachmentNotFound:
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Attachment not found or already sent")
+		case ws.ErrBroadcastPayloadTooLarge:
+			return utils.ResponseError(c, fiber.StatusRequestEntityTooLarge, "Message is too large to be delivered")
+		default:
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save new message")
+		}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Save New Message", fiber.Map{
+		"message": message,
+	})
+}
+
+func (h *MessageHandler) EditMessage(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	editInput := new(models.MessageEdit)
+	if err := c.BodyParser(editInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	editInput.Content = strings.TrimSpace(editInput.Content)
+
+	if err := utils.ValidateStruct(editInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Id":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message ID must be numeric and required")
+			case "Content":
+				if err.Tag() == "max" {
+					return utils.ResponseError(c, fiber.StatusBadRequest, fmt.Sprintf("Message Content max %d characters", models.MESSAGE_MAX_LENGTH))
+				}
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message Content is required")
 			}
 		}
 	}
@@ -310,29 +677,443 @@ func (h *MessageHandler) SaveNewMessage(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
 	}
+	// broadcast only sent after the change committed, so client never see change that rolled back
+	var onCommit []func()
 	defer func() {
-		database.CommitOrRollback(tx, c, err)
+		database.CommitOrRollback(tx, c, err, onCommit...)
 	}()
 
-	// check if room exist
-	isRoomExist, err := h.roomChatRepo.FindByCodeOrAndId(tx, NewMessage.RoomCode, 0)
+	messageData, err := h.message.FindById(tx, editInput.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check message")
+	}
+
+	if messageData.Id == 0 || messageData.Deleted {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Message not found")
+	}
+
+	// only sender can edit the message
+	if messageData.SenderId != user.Id {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to edit this message")
+	}
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", messageData.RoomId)
 	if err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
 	}
 
-	if isRoomExist.Id == 0 {
-		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	if roomData.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message on train room can't be edited")
 	}
 
-	// save new message
-	message := models.Message{
-		RoomId:   isRoomExist.Id,
-		SenderId: NewMessage.SenderId,
-		Content:  NewMessage.Content,
+	messageData.Content = editInput.Content
+	isUpdated, err := h.message.Update(tx, messageData, utils.MessageEditWindow())
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to edit message")
 	}
-	if err := h.message.Create(tx, &message); err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to save new message")
+
+	if !isUpdated {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message can't be edited anymore, edit time window has passed")
+	}
+
+	editedEvent, err := h.wsManager.PrepareBroadcast(roomData.RoomCode, ws.EventMessageEdited, ws.MessageEditedEvent{
+		Id:       messageData.Id,
+		RoomCode: roomData.RoomCode,
+		Content:  messageData.Content,
+		EditedAt: messageData.EditedAt,
+	})
+	if err != nil {
+		if err == ws.ErrBroadcastPayloadTooLarge {
+			return utils.ResponseError(c, fiber.StatusRequestEntityTooLarge, "Message is too large to be delivered")
+		}
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to edit message")
+	}
+
+	onCommit = append(onCommit, func() {
+		if err := h.wsManager.Publish(editedEvent); err != nil {
+			log.Println("error broadcast message edited: ", err)
+		}
+	})
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Edit Message", fiber.Map{
+		"message": messageData,
+	})
+}
+
+func (h *MessageHandler) DeleteMessage(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	deleteInput := new(models.MessageDelete)
+	if err := c.BodyParser(deleteInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(deleteInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Id":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message ID must be numeric and required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// broadcast only sent after the change committed, so client never see change that rolled back
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	messageData, err := h.message.FindById(tx, deleteInput.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check message")
+	}
+
+	if messageData.Id == 0 || messageData.Deleted {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Message not found")
+	}
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", messageData.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message on train room can't be deleted")
+	}
+
+	// sender can delete their own message and room owner/moderator can delete any message in the room
+	if messageData.SenderId != user.Id {
+		isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomData, user.Id, permission.ActionDeleteMessage)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+		}
+
+		if !isAllowed {
+			return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to delete this message")
+		}
+	}
+
+	// attachment of deleted message is removed too, the stored file deleted after the message deleted
+	attachments, err := h.attachmentRepo.FindByMessage(tx, messageData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get message attachment")
+	}
+
+	if err = h.attachmentRepo.DeleteByMessage(tx, messageData.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to delete message attachment")
+	}
+
+	if err = h.message.Delete(tx, messageData.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to delete message")
+	}
+
+	// deleted message can't stay pinned
+	isUnpinned, err := h.pinRepo.DeleteByMessage(tx, messageData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to unpin message")
+	}
+
+	var pins *[]models.PinnedMessageShow
+	if isUnpinned {
+		pins, err = h.pinRepo.FindByRoom(tx, roomData.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get pinned message")
+		}
+	}
+
+	// stored file deleted after commit, so the file still exist when the deletion rolled back
+	onCommit = append(onCommit, func() {
+		for _, file := range *attachments {
+			storage.DeleteAll(h.storage, file.StorageKey, file.ThumbnailKey)
+		}
+
+		if err := h.wsManager.BroadcastEvent(roomData.RoomCode, ws.EventMessageDeleted, ws.MessageDeletedEvent{
+			Id:       messageData.Id,
+			RoomCode: roomData.RoomCode,
+			ParentId: messageData.ParentId,
+		}); err != nil {
+			log.Println("error broadcast message deleted: ", err)
+		}
+
+		if isUnpinned {
+			h.broadcastPins(roomData.RoomCode, messageData.Id, models.PIN_REMOVED, pins)
+		}
+	})
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Delete Message")
+}
+
+func (h *MessageHandler) AddReaction(c *fiber.Ctx) error {
+	return h.updateReaction(c, models.REACTION_ADDED)
+}
+
+func (h *MessageHandler) RemoveReaction(c *fiber.Ctx) error {
+	return h.updateReaction(c, models.REACTION_REMOVED)
+}
+
+// updateReaction add or remove reaction of the user on the message, only room owner and member can react
+func (h *MessageHandler) updateReaction(c *fiber.Ctx, action string) error {
+	user := c.Locals("user").(models.UserSession)
+
+	reactionInput := new(models.MessageReactionInput)
+	if err := c.BodyParser(reactionInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	reactionInput.Emoji = strings.TrimSpace(reactionInput.Emoji)
+
+	if err := utils.ValidateStruct(reactionInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "MessageId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message ID must be numeric and required")
+			case "Emoji":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Emoji is required")
+			}
+		}
+	}
+
+	if !utils.IsEmoji(reactionInput.Emoji) {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Reaction must be a single emoji")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// broadcast only sent after the change committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	messageData, err := h.message.FindById(tx, reactionInput.MessageId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check message")
+	}
+
+	if messageData.Id == 0 || messageData.Deleted {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Message not found")
+	}
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", messageData.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message on train room can't be reacted")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomData, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if userRole == "" {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+	}
+
+	reaction := models.MessageReaction{
+		MessageId: messageData.Id,
+		UserId:    user.Id,
+		Emoji:     reactionInput.Emoji,
+	}
+
+	var isChanged bool
+	if action == models.REACTION_ADDED {
+		isChanged, err = h.reactionRepo.Create(tx, &reaction)
+	} else {
+		isChanged, err = h.reactionRepo.Delete(tx, &reaction)
+	}
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to update reaction")
+	}
+
+	count, err := h.reactionRepo.CountByEmoji(tx, messageData.Id, reaction.Emoji)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to count reaction")
+	}
+
+	// reaction already on the requested state, no need to broadcast
+	if isChanged {
+		onCommit = append(onCommit, func() {
+			if err := h.wsManager.BroadcastEvent(roomData.RoomCode, ws.EventReactionUpdated, ws.ReactionUpdatedEvent{
+				MessageId: messageData.Id,
+				RoomCode:  roomData.RoomCode,
+				UserId:    user.Id,
+				Username:  user.Username,
+				Emoji:     reaction.Emoji,
+				Action:    action,
+				Count:     count,
+			}); err != nil {
+				log.Println("error broadcast reaction updated: ", err)
+			}
+		})
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Update Reaction", fiber.Map{
+		"message_id":    messageData.Id,
+		"emoji":         reaction.Emoji,
+		"count":         count,
+		"reacted_by_me": action == models.REACTION_ADDED,
+	})
+}
+
+func (h *MessageHandler) PinMessage(c *fiber.Ctx) error {
+	return h.updatePin(c, models.PIN_ADDED)
+}
+
+func (h *MessageHandler) UnpinMessage(c *fiber.Ctx) error {
+	return h.updatePin(c, models.PIN_REMOVED)
+}
+
+// updatePin pin or unpin message in the room, only room owner and moderator can pin message
+func (h *MessageHandler) updatePin(c *fiber.Ctx, action string) error {
+	user := c.Locals("user").(models.UserSession)
+
+	pinInput := new(models.MessagePin)
+	if err := c.BodyParser(pinInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(pinInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "MessageId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message ID must be numeric and required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// broadcast only sent after the change committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	messageData, err := h.message.FindById(tx, pinInput.MessageId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check message")
+	}
+
+	if messageData.Id == 0 || messageData.Deleted {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Message not found")
+	}
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", messageData.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Message on train room can't be pinned")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomData, user.Id, permission.ActionPinMessage)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to pin message in this room")
+	}
+
+	var isChanged bool
+	if action == models.PIN_ADDED {
+		var totalPins int
+		totalPins, err = h.pinRepo.CountByRoom(tx, roomData.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to count pinned message")
+		}
+
+		if totalPins >= models.MAX_PINNED_MESSAGE {
+			return utils.ResponseError(c, fiber.StatusBadRequest, fmt.Sprintf("Max %d pinned message in one room", models.MAX_PINNED_MESSAGE))
+		}
+
+		isChanged, err = h.pinRepo.Create(tx, &models.PinnedMessage{
+			RoomId:    roomData.Id,
+			MessageId: messageData.Id,
+			PinnedBy:  user.Id,
+		})
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to pin message")
+		}
+	} else {
+		isChanged, err = h.pinRepo.DeleteByMessage(tx, messageData.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to unpin message")
+		}
+	}
+
+	pins, err := h.pinRepo.FindByRoom(tx, roomData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get pinned message")
+	}
+
+	if len(*pins) == 0 {
+		pins = &[]models.PinnedMessageShow{}
+	}
+
+	// message already on the requested state, no need to broadcast
+	if isChanged {
+		onCommit = append(onCommit, func() {
+			h.broadcastPins(roomData.RoomCode, messageData.Id, action, pins)
+		})
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Update Pinned Message", fiber.Map{
+		"message_id": messageData.Id,
+		"pinned":     action == models.PIN_ADDED,
+		"pins":       pins,
+	})
+}
+
+// broadcastPins send the latest pinned message list to the room
+func (h *MessageHandler) broadcastPins(roomCode string, messageId int, action string, pins *[]models.PinnedMessageShow) {
+	pinList := []models.PinnedMessageShow{}
+	if pins != nil && len(*pins) > 0 {
+		pinList = *pins
+	}
+
+	if err := h.wsManager.BroadcastEvent(roomCode, ws.EventPinsUpdated, ws.PinsUpdatedEvent{
+		RoomCode:  roomCode,
+		MessageId: messageId,
+		Action:    action,
+		Pins:      pinList,
+	}); err != nil {
+		log.Println("error broadcast pins updated: ", err)
+	}
+}
+
+// attachReactions set aggregated reaction of every message, deleted message not showing any reaction
+func (h *MessageHandler) attachReactions(tx *sql.Tx, messages []models.MessageShow, userId int) error {
+	messageIds := make([]int, 0, len(messages))
+	for _, message := range messages {
+		if !message.Deleted {
+			messageIds = append(messageIds, message.Id)
+		}
+	}
+
+	reactions, err := h.reactionRepo.FindSummaryByMessages(tx, messageIds, userId)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].Id]
+		if messages[i].Deleted || messages[i].Reactions == nil {
+			messages[i].Reactions = []models.MessageReactionSummary{}
+		}
 	}
 
-	return utils.ResponseMessage(c, fiber.StatusOK, "Success Save New Message")
+	return nil
 }
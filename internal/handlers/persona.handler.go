@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+	trainpersona "github.com/momokii/simple-chat-app/internal/repository/train_persona"
+	"github.com/momokii/simple-chat-app/pkg/utils"
+)
+
+type PersonaHandler struct {
+	personaRepo trainpersona.TrainPersonaRepo
+}
+
+func NewPersonaHandler(personaRepo trainpersona.TrainPersonaRepo) *PersonaHandler {
+	return &PersonaHandler{
+		personaRepo: personaRepo,
+	}
+}
+
+// personaFieldError response for persona field validation, persona_text tag failed when the text is multi line or look like prompt instruction
+func personaFieldError(c *fiber.Ctx, err validator.FieldError) error {
+	fieldName := map[string]string{
+		"Name":           "Name",
+		"EmploymentType": "Employment Type",
+		"Description":    "Description",
+		"Hobby":          "Hobby",
+		"Personality":    "Personality",
+	}[err.Field()]
+	if fieldName == "" {
+		fieldName = err.Field()
+	}
+
+	switch err.Tag() {
+	case "required":
+		return utils.ResponseError(c, fiber.StatusBadRequest, fieldName+" is required")
+	case "max":
+		return utils.ResponseError(c, fiber.StatusBadRequest, fmt.Sprintf("%s max %s characters", fieldName, err.Param()))
+	case "persona_text":
+		return utils.ResponseError(c, fiber.StatusBadRequest, fieldName+" must be single line text without markup character (` < > { } [ ]) or instruction phrase")
+	default:
+		return utils.ResponseError(c, fiber.StatusBadRequest, fieldName+" is not valid")
+	}
+}
+
+// personaValidationError response for persona create and edit input
+func personaValidationError(c *fiber.Ctx, err error) error {
+	for _, err := range err.(validator.ValidationErrors) {
+		switch err.Field() {
+		case "Id":
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Persona ID is required")
+		case "Gender":
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Gender is required and must be male or female")
+		case "Language":
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Language is required and must be indonesia or english")
+		case "RangeAge":
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Range Age is required and must be 18-24, 25-30, 31-40 or 41-50")
+		default:
+			return personaFieldError(c, err)
+		}
+	}
+
+	return nil
+}
+
+// GetPersonaList get persona library of the user, contain curated, shared and the user persona
+func (h *PersonaHandler) GetPersonaList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	// QUERY PARAMS
+	page := c.QueryInt("page")
+	if page == 0 {
+		page = 1
+	}
+	per_page := c.QueryInt("per_page")
+	if per_page == 0 {
+		per_page = 10
+	}
+	search := c.Query("search")
+	scope := c.Query("scope", models.PERSONA_SCOPE_ALL)
+
+	switch scope {
+	case models.PERSONA_SCOPE_ALL, models.PERSONA_SCOPE_MINE, models.PERSONA_SCOPE_CURATED, models.PERSONA_SCOPE_SHARED:
+	default:
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Scope must be all, mine, curated or shared")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	personas, total, err := h.personaRepo.FindVisible(tx, user.Id, scope, search, page, per_page)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get persona list")
+	}
+
+	if len(*personas) == 0 {
+		personas = &[]models.TrainPersona{}
+	}
+
+	// count total page
+	total_page := int(math.Ceil(float64(total) / float64(per_page)))
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Persona List", fiber.Map{
+		"personas": personas,
+		"pagination": fiber.Map{
+			"current_page": page,
+			"per_page":     per_page,
+			"total_items":  total,
+			"total_page":   total_page,
+		},
+	})
+}
+
+func (h *PersonaHandler) CreatePersona(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	personaInput := new(models.TrainPersonaCreate)
+	if err := c.BodyParser(personaInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(personaInput); err != nil {
+		return personaValidationError(c, err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	newPersona := models.TrainPersona{
+		CreatedBy:       user.Id,
+		CreatorUsername: user.Username,
+		Name:            personaInput.Name,
+		Gender:          personaInput.Gender,
+		Language:        personaInput.Language,
+		RangeAge:        personaInput.RangeAge,
+		EmploymentType:  personaInput.EmploymentType,
+		Description:     personaInput.Description,
+		Hobby:           personaInput.Hobby,
+		Personality:     personaInput.Personality,
+		IsShared:        personaInput.IsShared,
+	}
+
+	if err = h.personaRepo.Create(tx, &newPersona); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create persona")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusCreated, "Success Create Persona", fiber.Map{
+		"persona": newPersona,
+	})
+}
+
+// EditPersona edit persona created by the user, include share or unshare the persona
+func (h *PersonaHandler) EditPersona(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	personaInput := new(models.TrainPersonaEdit)
+	if err := c.BodyParser(personaInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(personaInput); err != nil {
+		return personaValidationError(c, err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	persona := models.TrainPersona{
+		Id:              personaInput.Id,
+		CreatedBy:       user.Id,
+		CreatorUsername: user.Username,
+		Name:            personaInput.Name,
+		Gender:          personaInput.Gender,
+		Language:        personaInput.Language,
+		RangeAge:        personaInput.RangeAge,
+		EmploymentType:  personaInput.EmploymentType,
+		Description:     personaInput.Description,
+		Hobby:           personaInput.Hobby,
+		Personality:     personaInput.Personality,
+		IsShared:        personaInput.IsShared,
+	}
+
+	updated, err := h.personaRepo.Update(tx, &persona)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to edit persona")
+	}
+
+	// curated persona and persona from other user can't be edited
+	if !updated {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Persona not found or you are not the creator")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Edit Persona", fiber.Map{
+		"persona": persona,
+	})
+}
+
+func (h *PersonaHandler) DeletePersona(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	personaInput := new(models.TrainPersonaDelete)
+	if err := c.BodyParser(personaInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Failed to parse request body")
+	}
+
+	if err := utils.ValidateStruct(personaInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Persona ID is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	deleted, err := h.personaRepo.Delete(tx, personaInput.Id, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to delete persona")
+	}
+
+	if !deleted {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Persona not found or you are not the creator")
+	}
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Delete Persona")
+}
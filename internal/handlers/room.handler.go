@@ -2,18 +2,29 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"log"
 	"math"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/momokii/go-llmbridge/pkg/openai"
 	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/llm"
 	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/permission"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	pinnedmessage "github.com/momokii/simple-chat-app/internal/repository/pinned_message"
 	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roomban "github.com/momokii/simple-chat-app/internal/repository/room_ban"
+	roominvite "github.com/momokii/simple-chat-app/internal/repository/room_invite"
+	roomjoinrequest "github.com/momokii/simple-chat-app/internal/repository/room_join_request"
 	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
 	"github.com/momokii/simple-chat-app/internal/repository/room_train"
+	roomtrainreport "github.com/momokii/simple-chat-app/internal/repository/room_train_report"
+	trainpersona "github.com/momokii/simple-chat-app/internal/repository/train_persona"
+	"github.com/momokii/simple-chat-app/internal/storage"
+	"github.com/momokii/simple-chat-app/internal/trainreport"
+	"github.com/momokii/simple-chat-app/internal/ws"
 	"github.com/momokii/simple-chat-app/pkg/utils"
 	"golang.org/x/crypto/bcrypt"
 
@@ -27,22 +38,42 @@ import (
 type RoomChatHandler struct {
 	roomChatRepo               room.RoomChatRepo
 	roomChatTrainRepo          room_train.RoomChatTrainRepo
+	roomTrainReportRepo        roomtrainreport.RoomTrainReportRepo
+	reportGenerator            *trainreport.Generator
 	roomMemberRepo             roommember.RoomMemberRepo
-	openaiClient               openai.OpenAI
+	roomBanRepo                roomban.RoomBanRepo
+	roomInviteRepo             roominvite.RoomInviteRepo
+	roomJoinRequestRepo        roomjoinrequest.RoomJoinRequestRepo
+	llmClient                  llm.Client
 	userRepo                   sso_user.UserRepo
 	reservedTokenRepo          sso_credit_reserved.UserCreditReserved
 	connRoomCreditReservedRepo sso_conn_room_reserved.ConnRoomCreditReserved
+	attachmentRepo             attachment.AttachmentRepo
+	pinRepo                    pinnedmessage.PinnedMessageRepo
+	personaRepo                trainpersona.TrainPersonaRepo
+	storage                    storage.Storage
+	wsManager                  *ws.Manager
 }
 
-func NewRoomChatHandler(roomChatRepo room.RoomChatRepo, roomTrainRepo room_train.RoomChatTrainRepo, roomMemberRepo roommember.RoomMemberRepo, openaiClient openai.OpenAI, userRepo sso_user.UserRepo, reservedTokenRepo sso_credit_reserved.UserCreditReserved, connRoomCreditReservedRepo sso_conn_room_reserved.ConnRoomCreditReserved) *RoomChatHandler {
+func NewRoomChatHandler(roomChatRepo room.RoomChatRepo, roomTrainRepo room_train.RoomChatTrainRepo, roomTrainReportRepo roomtrainreport.RoomTrainReportRepo, reportGenerator *trainreport.Generator, roomMemberRepo roommember.RoomMemberRepo, roomBanRepo roomban.RoomBanRepo, roomInviteRepo roominvite.RoomInviteRepo, roomJoinRequestRepo roomjoinrequest.RoomJoinRequestRepo, llmClient llm.Client, userRepo sso_user.UserRepo, reservedTokenRepo sso_credit_reserved.UserCreditReserved, connRoomCreditReservedRepo sso_conn_room_reserved.ConnRoomCreditReserved, attachmentRepo attachment.AttachmentRepo, pinRepo pinnedmessage.PinnedMessageRepo, personaRepo trainpersona.TrainPersonaRepo, storage storage.Storage, wsManager *ws.Manager) *RoomChatHandler {
 	return &RoomChatHandler{
 		roomChatRepo:               roomChatRepo,
 		roomChatTrainRepo:          roomTrainRepo,
+		roomTrainReportRepo:        roomTrainReportRepo,
+		reportGenerator:            reportGenerator,
 		roomMemberRepo:             roomMemberRepo,
-		openaiClient:               openaiClient,
+		roomBanRepo:                roomBanRepo,
+		roomInviteRepo:             roomInviteRepo,
+		roomJoinRequestRepo:        roomJoinRequestRepo,
+		llmClient:                  llmClient,
 		userRepo:                   userRepo,
 		reservedTokenRepo:          reservedTokenRepo,
 		connRoomCreditReservedRepo: connRoomCreditReservedRepo,
+		attachmentRepo:             attachmentRepo,
+		pinRepo:                    pinRepo,
+		personaRepo:                personaRepo,
+		storage:                    storage,
+		wsManager:                  wsManager,
 	}
 }
 
@@ -115,13 +146,128 @@ func (h *RoomChatHandler) GetTrainRoomData(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get train room data")
 	}
 
+	// coaching report only exist after the session ended and the report generated
+	report, err := h.roomTrainReportRepo.FindByRoomCode(tx, roomCode)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get train report")
+	}
+
+	var reportData *models.RoomChatTrainReport
+	if report.Id != 0 {
+		reportData = report
+	}
+
 	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Train Room Data", fiber.Map{
 		"room":        checkRoom,
 		"room_detail": trainRoomDetail,
+		"report":      reportData,
+	})
+}
+
+// GetTrainReport get the coaching report of ended train session
+func (h *RoomChatHandler) GetTrainReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	checkRoom, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if checkRoom.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if !checkRoom.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "This is not train room")
+	}
+
+	// report is private for the train room creator
+	if checkRoom.CreatedBy != user.Id {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to access this page")
+	}
+
+	report, err := h.roomTrainReportRepo.FindByRoomCode(tx, roomCode)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get train report")
+	}
+
+	if report.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Train report is not generated yet")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Train Report", fiber.Map{
+		"report": report,
+	})
+}
+
+// CreateTrainReport get the coaching report of ended train session and generate it again when the background generation failed
+// report only generated once for every train room, the saved report returned when it already exist
+func (h *RoomChatHandler) CreateTrainReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	// room checked on short transaction, so no transaction held while the report generated
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+
+	checkRoom, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err := database.CommitOrRollback(tx, nil, err); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if checkRoom.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if !checkRoom.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "This is not train room")
+	}
+
+	if checkRoom.CreatedBy != user.Id {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to access this page")
+	}
+
+	report, err := h.reportGenerator.Generate(c.Context(), checkRoom)
+	if err != nil {
+		switch err {
+		case trainreport.ErrTrainNotFound:
+			return utils.ResponseError(c, fiber.StatusNotFound, "Train room data not found")
+		case trainreport.ErrSessionNotEnded:
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Train session is not ended yet")
+		case trainreport.ErrNoMessage:
+			return utils.ResponseError(c, fiber.StatusBadRequest, "Train session don't have any message")
+		default:
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to generate train report")
+		}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Train Report", fiber.Map{
+		"report": report,
 	})
 }
 
 func (h *RoomChatHandler) GetRoomData(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
 	roomCode := c.Params("room_code")
 	if roomCode == "" {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
@@ -160,9 +306,72 @@ func (h *RoomChatHandler) GetRoomData(c *fiber.Ctx) error {
 		members = &[]models.RoomMemberShow{}
 	}
 
+	// role of current user in the room, empty if user is not member of the room
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomData, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	// pinned message of private room only showed to the room member, same as the message list
+	pins := &[]models.PinnedMessageShow{}
+	if !roomData.IsPrivate || userRole != "" {
+		pins, err = h.pinRepo.FindByRoom(tx, roomData.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get pinned message")
+		}
+
+		if len(*pins) == 0 {
+			pins = &[]models.PinnedMessageShow{}
+		}
+	}
+
 	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Data", fiber.Map{
-		"room":    roomData,
-		"members": members,
+		"room":      roomData,
+		"members":   members,
+		"user_role": userRole,
+		"pins":      pins,
+	})
+}
+
+func (h *RoomChatHandler) GetRoomOnlineUsers(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	// only creator and member of the room can see who is online
+	if roomData.CreatedBy != user.Id {
+		isMember, err := h.roomMemberRepo.FindUserInRoom(tx, user.Id, roomData.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+		}
+
+		if !isMember {
+			return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not a member of this room")
+		}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Online Users", fiber.Map{
+		"online": h.wsManager.OnlineUsers(roomData.RoomCode),
 	})
 }
 
@@ -238,16 +447,31 @@ func (h *RoomChatHandler) CreateTrainRoom(c *fiber.Ctx) error {
 	if err := utils.ValidateStruct(roomTrain); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Field() {
+			case "PersonaId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Persona ID must be positive number")
 			case "Gender":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "Gender is required")
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Gender is required and must be male or female")
 			case "Language":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "Language is required")
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Language is required and must be indonesia or english")
 			case "RangeAge":
-				return utils.ResponseError(c, fiber.StatusBadRequest, "Range Age is required")
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Range Age is required and must be 18-24, 25-30, 31-40 or 41-50")
+			default:
+				return personaFieldError(c, err)
 			}
 		}
 	}
 
+	// edited persona detail must be complete, partial detail can't be mixed with the generated one
+	detailFilled := 0
+	for _, detail := range []string{roomTrain.EmploymentType, roomTrain.Description, roomTrain.Hobby, roomTrain.Personality} {
+		if detail != "" {
+			detailFilled++
+		}
+	}
+	if detailFilled != 0 && detailFilled != 4 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Persona detail (employment type, description, hobby and personality) must be filled completely or left empty")
+	}
+
 	// start tx
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -273,72 +497,40 @@ func (h *RoomChatHandler) CreateTrainRoom(c *fiber.Ctx) error {
 
 	// start process
 
-	// init message to openai to get description for train room mate using llm
-	baseMessageReq := fmt.Sprintf(`"Buat profil *fictional* untuk simulasi dating app (Tinder/Bumble vibe) dengan kriteria yang akan dijelaskan di bawah. 
-	Pastikan bahasanya SUPER CASUAL, pakai slang gen Z, emoji, dan deskripsi unik ala bio Instagram/Tinder/Bumble pada umumnya.
-	
-	Hindari kalimat sangat formal—bayangkan seperti sedang bikin profil buat temen yang sok asik!". 
-	
-	Data dasar yang dimiliki dan diprovide adalah berikut: 
-		Gender: %s 
-		Range Age: %s 
-		Main Language: %s
-
-	Berdasarkan data di atas, Tambahkan detail dengan poin yang ada di bawah ini dengan disesuaikan dengan data yang diberikan di atas (gender, language, dan range age):
-		1. Employment Type, bisa berikan penjelasan bagian ini secara sederhana atau unik juga bisa
-
-		2. Description: 
-		- Fokus pada kebiasaan unik & relatable, contoh sebagai referensi (selalu coba untuk membuatnya beda dari contoh diberikan jika memungkinkan): 
-			- "Cewek yang bisa nangis nonton Drakor, tapi juga bisa gebukin tikus pake sandal jepit 😤" 
-			- "Cowok pecinta kopi hitam & motor tua. Auto ghosting kalo lo bilang 'es kopi susu lebih enak' ☕"
-		- Bisa hanya sekadar sederhana, contoh:
-			- "Cewek yang suka jalan-jalan"
-			- "Cowok yang suka main game"
-
-		3. Hobby: 
-		- Pakai format visual + emoji, contoh sebagai referensi (selalu coba untuk membuatnya beda dari contoh diberikan jika memungkinkan): 
-			- "Nyari spot aestetik buat feed IG 📸 | Bikin playlist Spotify buat setiap mood (galau, semangat, atau pengen jadi ikan 🐠)" 
-			- "Nge-gym... eh, maksudnya foto di gym terus post story 🏋️♂️"
-		- Bisa hanya sekadar sederhana, contoh:
-			- "Main game"
-			- "Nonton film"
-
-		4. Personality: 
-		- Gabungkan sifat + kebiasaan random, contoh sebagai referensi (selalu coba untuk membuatnya beda dari contoh diberikan jika memungkinkan): 
-			- "Kocak ga jelas tapi bisa deep talk ✨ | Suka marahin diri sendiri kalo lupa nyimpen kunci 🔑" 
-			- "Humor sarkas level 100 🗡️ | Auto jadi ibu-ibu kalo liat orang parkir sembarangan 🚗💢"
-		- Bisa hanya sekadar sederhana, contoh:
-			- "Pluviofile"
-			- "Introvert"
-	`, roomTrain.Gender, roomTrain.RangeAge, roomTrain.Language)
-	baseResponseFormat := openai.OACreateResponseFormat(
-		"base_format_response",
-		map[string]interface{}{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"employment_type": map[string]interface{}{"type": "string"},
-				"description":     map[string]interface{}{"type": "string"},
-				"hobby":           map[string]interface{}{"type": "string"},
-				"personality":     map[string]interface{}{"type": "string"},
-			},
-		},
-	)
-
-	initMessage := []openai.OAMessageReq{
-		{
-			Role:    "user",
-			Content: baseMessageReq,
-		},
-	}
+	// persona from library is used as is, edited detail from user is used without LLM, otherwise generate persona detail for train room mate using llm
+	var initResData *models.RoomChatTrainCreationRes
+	if roomTrain.PersonaId != 0 {
+		persona, err := h.personaRepo.FindById(tx, roomTrain.PersonaId)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get persona")
+		}
 
-	initResponse, err := h.openaiClient.OpenAIGetFirstContentDataResp(&initMessage, true, &baseResponseFormat, false, nil)
-	if err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get initial message response")
-	}
+		if persona.Id == 0 || !(persona.IsCurated || persona.IsShared || persona.CreatedBy == user.Id) {
+			return utils.ResponseError(c, fiber.StatusNotFound, "Persona not found")
+		}
 
-	initResData := new(models.RoomChatTrainCreationRes)
-	if err := json.Unmarshal([]byte(initResponse.Content), initResData); err != nil {
-		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to marshal response")
+		roomTrain.Gender = persona.Gender
+		roomTrain.Language = persona.Language
+		roomTrain.RangeAge = persona.RangeAge
+		initResData = &models.RoomChatTrainCreationRes{
+			EmploymentType: persona.EmploymentType,
+			Description:    persona.Description,
+			Hobby:          persona.Hobby,
+			Personality:    persona.Personality,
+		}
+	} else if detailFilled == 4 {
+		initResData = &models.RoomChatTrainCreationRes{
+			EmploymentType: roomTrain.EmploymentType,
+			Description:    roomTrain.Description,
+			Hobby:          roomTrain.Hobby,
+			Personality:    roomTrain.Personality,
+		}
+	} else {
+		initResData, err = h.llmClient.GeneratePersona(c.Context(), roomTrain)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get initial message response")
+		}
+		sanitizePersonaDetail(initResData)
 	}
 
 	// first add new room data (basic room data)
@@ -417,6 +609,130 @@ func (h *RoomChatHandler) CreateTrainRoom(c *fiber.Ctx) error {
 	return utils.ResponseMessage(c, fiber.StatusOK, "Success Create Train Room")
 }
 
+// GenerateTrainPersona generate persona detail preview with LLM, so user can edit the detail before create the train room
+// every preview charged with preview cost after the persona generated, the train room cost still deducted when the room created
+// no transaction held while the persona generated
+func (h *RoomChatHandler) GenerateTrainPersona(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	personaInput := new(models.RoomChatTrainPersonaGenerate)
+	if err := c.BodyParser(personaInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(personaInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Gender":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Gender is required and must be male or female")
+			case "Language":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Language is required and must be indonesia or english")
+			case "RangeAge":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Range Age is required and must be 18-24, 25-30, 31-40 or 41-50")
+			}
+		}
+	}
+
+	// only user that can pay the preview and still create the train room can generate the persona
+	if err := h.checkPersonaPreviewCredit(user.Id); err != nil {
+		return trainErrorResponse(c, err, "Failed to get user data")
+	}
+
+	persona, err := h.llmClient.GeneratePersona(c.Context(), &models.RoomChatTrainCreate{
+		Gender:   personaInput.Gender,
+		RangeAge: personaInput.RangeAge,
+		Language: personaInput.Language,
+	})
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to generate persona")
+	}
+	sanitizePersonaDetail(persona)
+
+	// failed generation is not charged
+	if err := h.chargePersonaPreview(user.Id); err != nil {
+		return trainErrorResponse(c, err, "Failed to deduct user credit")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Generate Persona", fiber.Map{
+		"persona": persona,
+	})
+}
+
+// checkPersonaPreviewCredit check the user credit is enough for the preview and the train room before the LLM called
+func (h *RoomChatHandler) checkPersonaPreviewCredit(userId int) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err)
+	}()
+
+	user_data, err := h.userRepo.FindByID(tx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user_data.Id == 0 {
+		err = fiber.NewError(fiber.StatusBadRequest, "User not found")
+		return err
+	}
+
+	if user_data.CreditToken < utils.FEATURE_DATING_PERSONA_PREVIEW_COST+utils.FEATURE_DATING_CHAT_SIMULATION_COST {
+		err = fiber.NewError(fiber.StatusBadRequest, "You don't have enough credit to generate persona and create this room")
+		return err
+	}
+
+	return nil
+}
+
+// chargePersonaPreview deduct the preview cost from the user credit after the persona generated
+func (h *RoomChatHandler) chargePersonaPreview(userId int) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err)
+	}()
+
+	// credit read again because it can be used while the persona generated
+	user_data, err := h.userRepo.FindByID(tx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user_data.Id == 0 {
+		err = fiber.NewError(fiber.StatusBadRequest, "User not found")
+		return err
+	}
+
+	if user_data.CreditToken < utils.FEATURE_DATING_PERSONA_PREVIEW_COST {
+		err = fiber.NewError(fiber.StatusBadRequest, "You don't have enough credit to generate persona")
+		return err
+	}
+
+	err = sso_utils.UpdateUserCredit(tx, h.userRepo, user_data, utils.FEATURE_DATING_PERSONA_PREVIEW_COST)
+	return err
+}
+
+// sanitizePersonaDetail keep the LLM generated persona on the persona length limit, so it still valid when edited or saved to library
+func sanitizePersonaDetail(persona *models.RoomChatTrainCreationRes) {
+	persona.EmploymentType = utils.SanitizePersonaText(persona.EmploymentType, models.PERSONA_EMPLOYMENT_TYPE_MAX_LENGTH)
+	persona.Description = utils.SanitizePersonaText(persona.Description, models.PERSONA_DESCRIPTION_MAX_LENGTH)
+	persona.Hobby = utils.SanitizePersonaText(persona.Hobby, models.PERSONA_HOBBY_MAX_LENGTH)
+	persona.Personality = utils.SanitizePersonaText(persona.Personality, models.PERSONA_PERSONALITY_MAX_LENGTH)
+}
+
+// joinPolicyFromPrivate used when client not send join policy, so old private/public flow still work
+func joinPolicyFromPrivate(isPrivate bool) string {
+	if isPrivate {
+		return models.JOIN_POLICY_PASSWORD
+	}
+
+	return models.JOIN_POLICY_OPEN
+}
+
 func (h *RoomChatHandler) CreateRoom(c *fiber.Ctx) error {
 	// get user data
 	user := c.Locals("user").(models.UserSession)
@@ -427,6 +743,12 @@ func (h *RoomChatHandler) CreateRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
 	}
 
+	// join policy not set follow the private status, and room is private when the room is not open for everyone
+	if room.JoinPolicy == "" {
+		room.JoinPolicy = joinPolicyFromPrivate(room.IsPrivate)
+	}
+	room.IsPrivate = room.JoinPolicy != models.JOIN_POLICY_OPEN
+
 	if err := utils.ValidateStruct(room); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Field() {
@@ -434,10 +756,12 @@ func (h *RoomChatHandler) CreateRoom(c *fiber.Ctx) error {
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Room Name must be alphanumeric and between 3-25 characters")
 			case "Description":
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Description must be alphanumeric and between 6-50 characters")
+			case "JoinPolicy":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Join policy must be open, password, approval or invite_only")
 			}
 
-			// if private, check password for private room
-			if room.IsPrivate {
+			// if password policy, check password for private room
+			if room.JoinPolicy == models.JOIN_POLICY_PASSWORD {
 				switch err.Field() {
 				case "Password":
 					return utils.ResponseError(c, fiber.StatusBadRequest, "Password is required for private room and must be alphanumeric and between 4-30 characters")
@@ -447,8 +771,8 @@ func (h *RoomChatHandler) CreateRoom(c *fiber.Ctx) error {
 		}
 	}
 
-	// if is private and passowrd is empty
-	if room.IsPrivate && room.Password == "" {
+	// if password policy and passowrd is empty
+	if room.JoinPolicy == models.JOIN_POLICY_PASSWORD && room.Password == "" {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Password is required for private room")
 	}
 
@@ -478,22 +802,24 @@ func (h *RoomChatHandler) CreateRoom(c *fiber.Ctx) error {
 
 	// create new room
 	roomData := models.RoomChat{
-		RoomCode:    codeRoom,
-		CreatedBy:   user.Id,
-		RoomName:    room.RoomName,
-		Description: room.Description,
-		IsTrainRoom: false,
+		RoomCode:       codeRoom,
+		CreatedBy:      user.Id,
+		RoomName:       room.RoomName,
+		Description:    room.Description,
+		IsTrainRoom:    false,
+		IsPrivate:      room.IsPrivate,
+		JoinPolicy:     room.JoinPolicy,
+		IsAnnouncement: room.IsAnnouncement,
 	}
 
-	// if private, hash password
-	if room.IsPrivate {
+	// if password policy, hash password
+	if room.JoinPolicy == models.JOIN_POLICY_PASSWORD {
 		passwordHashed, err := bcrypt.GenerateFromPassword([]byte(room.Password), 16)
 		if err != nil {
 			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to hash password")
 		}
 
 		roomData.Password = string(passwordHashed)
-		roomData.IsPrivate = true
 	}
 
 	if err := h.roomChatRepo.Create(tx, &roomData); err != nil {
@@ -511,6 +837,12 @@ func (h *RoomChatHandler) EditRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
 	}
 
+	if roomUpdateInput.JoinPolicy == "" {
+		roomUpdateInput.JoinPolicy = joinPolicyFromPrivate(roomUpdateInput.IsPrivate)
+	}
+	roomUpdateInput.IsPrivate = roomUpdateInput.JoinPolicy != models.JOIN_POLICY_OPEN
+	isPasswordPolicy := roomUpdateInput.JoinPolicy == models.JOIN_POLICY_PASSWORD
+
 	if err := utils.ValidateStruct(roomUpdateInput); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Field() {
@@ -520,11 +852,13 @@ func (h *RoomChatHandler) EditRoom(c *fiber.Ctx) error {
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Room Name must be alphanumeric and between 3-25 characters")
 			case "Description":
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Description must be alphanumeric and between 6-50 characters")
+			case "JoinPolicy":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Join policy must be open, password, approval or invite_only")
 			}
 
-			// check new password error if room is private and the private is change form before is public and change to private
-			// or if room is private and password is not empty
-			if (roomUpdateInput.IsPrivate && !roomUpdateInput.OldStatus) || (roomUpdateInput.IsPrivate && roomUpdateInput.Password != "") {
+			// check new password error if room is password policy and the policy is change form before is public and change to private
+			// or if room is password policy and password is not empty
+			if (isPasswordPolicy && !roomUpdateInput.OldStatus) || (isPasswordPolicy && roomUpdateInput.Password != "") {
 				switch err.Field() {
 				case "Password":
 					return utils.ResponseError(c, fiber.StatusBadRequest, "Password is required for private room and must be alphanumeric and between 4-30 characters")
@@ -552,26 +886,38 @@ func (h *RoomChatHandler) EditRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusNotFound, "Room not found")
 	}
 
-	// if exist, check if user is the creator or not
-	if isRoomExist.CreatedBy != user.Id {
+	// if exist, check if user role is allowed to edit the room
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, isRoomExist, user.Id, permission.ActionEditRoom)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
 		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to edit this room")
 	}
 
+	// room without password (e.g. open or approval policy before) need new password when changed to password policy
+	if isPasswordPolicy && isRoomExist.Password == "" && roomUpdateInput.Password == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Password is required for private room")
+	}
+
 	// update rrom data
 	isUpdatePassword := false // false can happen like when room is public and change to public or private to private and password is empty
 	updateRoom := models.RoomChat{
-		Id:          roomUpdateInput.Id,
-		RoomName:    roomUpdateInput.RoomName,
-		Description: roomUpdateInput.Description,
-		IsPrivate:   roomUpdateInput.IsPrivate,
-	}
-	// if the room is private and new data change to public, remove password
-	if isRoomExist.IsPrivate && !roomUpdateInput.IsPrivate {
+		Id:             roomUpdateInput.Id,
+		RoomName:       roomUpdateInput.RoomName,
+		Description:    roomUpdateInput.Description,
+		IsPrivate:      roomUpdateInput.IsPrivate,
+		JoinPolicy:     roomUpdateInput.JoinPolicy,
+		IsAnnouncement: roomUpdateInput.IsAnnouncement,
+	}
+	// if the room have password and new policy is not password, remove password
+	if isRoomExist.Password != "" && !isPasswordPolicy {
 		updateRoom.Password = ""
 		isUpdatePassword = true
 
-	} else if (isRoomExist.IsPrivate && roomUpdateInput.IsPrivate && roomUpdateInput.Password != "") || (!isRoomExist.IsPrivate && roomUpdateInput.IsPrivate && roomUpdateInput.Password != "") {
-		// if the room is private and password is not empty, hash the password
+	} else if isPasswordPolicy && roomUpdateInput.Password != "" {
+		// if the room is password policy and password is not empty, hash the password
 
 		newHashedPass, err := bcrypt.GenerateFromPassword([]byte(roomUpdateInput.Password), 16)
 		if err != nil {
@@ -617,8 +963,10 @@ func (h *RoomChatHandler) DeleteRoom(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction: ")
 	}
+	// stored file only deleted after the room deletion committed
+	var onCommit []func()
 	defer func() {
-		database.CommitOrRollback(tx, c, err)
+		database.CommitOrRollback(tx, c, err, onCommit...)
 	}()
 
 	// check if room is exist
@@ -631,8 +979,13 @@ func (h *RoomChatHandler) DeleteRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusNotFound, "Room not found")
 	}
 
-	// if exist, check if user is the creator or not
-	if user.Id != isRoomExist.CreatedBy {
+	// if exist, check if user role is allowed to delete the room
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, isRoomExist, user.Id, permission.ActionDeleteRoom)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
 		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to delete this room")
 	}
 
@@ -663,11 +1016,23 @@ func (h *RoomChatHandler) DeleteRoom(c *fiber.Ctx) error {
 
 	}
 
+	// attachment data deleted with the room by foreign key, so the stored file need to be deleted here
+	attachments, err := h.attachmentRepo.FindByRoom(tx, roomDelete.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get room attachment")
+	}
+
 	// delete room
-	if err := h.roomChatRepo.Delete(tx, roomDelete.Id); err != nil {
+	if err = h.roomChatRepo.Delete(tx, roomDelete.Id); err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to delete room")
 	}
 
+	onCommit = append(onCommit, func() {
+		for _, file := range *attachments {
+			storage.DeleteAll(h.storage, file.StorageKey, file.ThumbnailKey)
+		}
+	})
+
 	return utils.ResponseMessage(c, fiber.StatusOK, "Success Delete Room")
 }
 
@@ -707,6 +1072,21 @@ func (h *RoomChatHandler) AddJoinRoom(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
 	}
 
+	// train room only used by the creator, so nobody can join it as member
+	if roomCheck.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Train room don't have member")
+	}
+
+	// banned user can't join the room until the ban expired
+	isBanned, err := h.roomBanRepo.FindActiveBan(tx, user.Id, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room ban")
+	}
+
+	if isBanned {
+		return utils.ResponseError(c, fiber.StatusForbidden, "You are banned from this room")
+	}
+
 	// check if user is already in the room
 	exist, err := h.roomMemberRepo.FindUserInRoom(tx, user.Id, memberInput.RoomId)
 	if err != nil {
@@ -716,8 +1096,9 @@ func (h *RoomChatHandler) AddJoinRoom(c *fiber.Ctx) error {
 	// if not exist so add user to the room
 	if !exist {
 
-		// check the room is private or not, if private check the password and if not private, just add user to the room
-		if roomCheck.IsPrivate {
+		// check the room join policy, password room need to check the password and open room just add user to the room
+		switch roomCheck.JoinPolicy {
+		case models.JOIN_POLICY_PASSWORD:
 			if memberInput.Password == "" {
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Password is required for private room")
 			}
@@ -725,6 +1106,10 @@ func (h *RoomChatHandler) AddJoinRoom(c *fiber.Ctx) error {
 			if err := bcrypt.CompareHashAndPassword([]byte(roomCheck.Password), []byte(memberInput.Password)); err != nil {
 				return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid password")
 			}
+		case models.JOIN_POLICY_APPROVAL:
+			return utils.ResponseError(c, fiber.StatusForbidden, "This room need approval to join, please send join request")
+		case models.JOIN_POLICY_INVITE_ONLY:
+			return utils.ResponseError(c, fiber.StatusForbidden, "This room is invite only, please use invite link to join")
 		}
 
 		newMember := models.RoomMember{
@@ -775,6 +1160,10 @@ func (h *RoomChatHandler) RemoveRoomMember(c *fiber.Ctx) error {
 		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
 	}
 
+	if roomCheck.IsDirect {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "You can't leave direct message")
+	}
+
 	// delete user from room member
 	if err := h.roomMemberRepo.Delete(tx, user.Id, delInput.RoomId); err != nil {
 		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to remove room member")
@@ -782,3 +1171,940 @@ func (h *RoomChatHandler) RemoveRoomMember(c *fiber.Ctx) error {
 
 	return utils.ResponseMessage(c, fiber.StatusOK, "Success Remove Room Member")
 }
+
+// UpdateRoomMemberRole promote or demote member of the room, only room owner can change member role
+func (h *RoomChatHandler) UpdateRoomMemberRole(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roleInput := new(models.RoomMemberRoleUpdate)
+	if err := c.BodyParser(roleInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(roleInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "UserId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "User ID must be numeric and required")
+			case "Role":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Role must be moderator or member")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", roleInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomCheck, user.Id, permission.ActionManageRole)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to change member role in this room")
+	}
+
+	// owner role can't be changed, so the target must be member of the room
+	targetRole, err := h.roomMemberRepo.FindRole(tx, roleInput.UserId, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if targetRole == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "User is not a member of this room")
+	}
+
+	if err := h.roomMemberRepo.UpdateRole(tx, &models.RoomMember{
+		RoomId: roomCheck.Id,
+		UserId: roleInput.UserId,
+		Role:   roleInput.Role,
+	}); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to update member role")
+	}
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Update Member Role")
+}
+
+// KickRoomMember remove other member from the room, the member still can join the room again
+func (h *RoomChatHandler) KickRoomMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	kickInput := new(models.RoomMemberKick)
+	if err := c.BodyParser(kickInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(kickInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "UserId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "User ID must be numeric and required")
+			case "Reason":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Reason must be less than 200 characters")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// user only removed from the connected room after the change committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", kickInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	targetRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, kickInput.UserId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if targetRole == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "User is not a member of this room")
+	}
+
+	// user only can kick member with lower role
+	if !permission.Can(userRole, permission.ActionKickMember) || !permission.CanManage(userRole, targetRole) {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to kick this member")
+	}
+
+	if err = h.roomMemberRepo.Delete(tx, kickInput.UserId, roomCheck.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to kick room member")
+	}
+
+	onCommit = append(onCommit, func() {
+		if err := h.wsManager.RemoveUserFromRoom(ws.RemovedFromRoomEvent{
+			RoomCode: roomCheck.RoomCode,
+			UserId:   kickInput.UserId,
+			Action:   ws.RemovedKicked,
+			Reason:   kickInput.Reason,
+		}); err != nil {
+			log.Println("error broadcast removed from room: ", err)
+		}
+	})
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Kick Room Member")
+}
+
+// BanRoomMember remove user from the room and prevent the user to join again until the ban expired or unbanned
+// user that not a member of the room also can be banned
+func (h *RoomChatHandler) BanRoomMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	banInput := new(models.RoomMemberBan)
+	if err := c.BodyParser(banInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(banInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "UserId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "User ID must be numeric and required")
+			case "Reason":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Reason must be less than 200 characters")
+			case "Duration":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Duration must be between 0 (permanent) and 525600 minutes")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// user only removed from the connected room after the change committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", banInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if roomCheck.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Train room don't have member")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	targetRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, banInput.UserId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if !permission.Can(userRole, permission.ActionBanMember) || !permission.CanManage(userRole, targetRole) {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to ban this user")
+	}
+
+	user_data, err := h.userRepo.FindByID(tx, banInput.UserId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get user data")
+	}
+
+	if user_data.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "User not found")
+	}
+
+	ban := models.RoomBan{
+		RoomId:   roomCheck.Id,
+		UserId:   banInput.UserId,
+		BannedBy: user.Id,
+		Reason:   banInput.Reason,
+	}
+	if err = h.roomBanRepo.Upsert(tx, &ban, banInput.Duration); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to ban user")
+	}
+
+	if targetRole != "" {
+		if err = h.roomMemberRepo.Delete(tx, banInput.UserId, roomCheck.Id); err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to remove room member")
+		}
+	}
+
+	onCommit = append(onCommit, func() {
+		if err := h.wsManager.RemoveUserFromRoom(ws.RemovedFromRoomEvent{
+			RoomCode:  roomCheck.RoomCode,
+			UserId:    banInput.UserId,
+			Action:    ws.RemovedBanned,
+			Reason:    banInput.Reason,
+			ExpiresAt: ban.ExpiresAt,
+		}); err != nil {
+			log.Println("error broadcast removed from room: ", err)
+		}
+	})
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Ban User")
+}
+
+func (h *RoomChatHandler) UnbanRoomMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	unbanInput := new(models.RoomMemberUnban)
+	if err := c.BodyParser(unbanInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(unbanInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "UserId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "User ID must be numeric and required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", unbanInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomCheck, user.Id, permission.ActionBanMember)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to unban user in this room")
+	}
+
+	if err := h.roomBanRepo.Delete(tx, unbanInput.UserId, roomCheck.Id); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to unban user")
+	}
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Unban User")
+}
+
+func (h *RoomChatHandler) GetRoomBanList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomData, user.Id, permission.ActionBanMember)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to see ban list of this room")
+	}
+
+	bans, err := h.roomBanRepo.FindByRoom(tx, roomData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get room ban list")
+	}
+
+	if len(*bans) == 0 {
+		bans = &[]models.RoomBanShow{}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Ban List", fiber.Map{
+		"bans": bans,
+	})
+}
+
+// --- below for room invite related function ---
+
+// CreateRoomInvite create invite token for the room, invited user join without the room password
+// only owner can create invite with moderator role
+func (h *RoomChatHandler) CreateRoomInvite(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	inviteInput := new(models.RoomInviteCreate)
+	if err := c.BodyParser(inviteInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(inviteInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "Role":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Role must be moderator or member")
+			case "MaxUses":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Max uses must be between 0 (unlimited) and 1000")
+			case "Duration":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Duration must be between 0 (never expired) and 525600 minutes")
+			}
+		}
+	}
+
+	if inviteInput.Role == "" {
+		inviteInput.Role = models.ROOM_ROLE_MEMBER
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", inviteInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if roomCheck.IsTrainRoom {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Train room can't have invite")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !permission.Can(userRole, permission.ActionInviteMember) {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to create invite for this room")
+	}
+
+	if inviteInput.Role != models.ROOM_ROLE_MEMBER && !permission.Can(userRole, permission.ActionManageRole) {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to create invite with this role")
+	}
+
+	token, err := utils.SecureRandomString(24)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to generate invite token")
+	}
+
+	invite := models.RoomInvite{
+		RoomId:    roomCheck.Id,
+		Token:     token,
+		CreatedBy: user.Id,
+		Role:      inviteInput.Role,
+		MaxUses:   inviteInput.MaxUses,
+	}
+	if err := h.roomInviteRepo.Create(tx, &invite, inviteInput.Duration); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create invite")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Create Room Invite", fiber.Map{
+		"invite": invite,
+	})
+}
+
+func (h *RoomChatHandler) GetRoomInviteList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomData, user.Id, permission.ActionInviteMember)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to see invite list of this room")
+	}
+
+	invites, err := h.roomInviteRepo.FindByRoom(tx, roomData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get room invite list")
+	}
+
+	if len(*invites) == 0 {
+		invites = &[]models.RoomInviteShow{}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Invite List", fiber.Map{
+		"invites": invites,
+	})
+}
+
+func (h *RoomChatHandler) RevokeRoomInvite(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	revokeInput := new(models.RoomInviteRevoke)
+	if err := c.BodyParser(revokeInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(revokeInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Id":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Invite ID must be numeric and required")
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", revokeInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomCheck, user.Id, permission.ActionInviteMember)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to revoke invite of this room")
+	}
+
+	isRevoked, err := h.roomInviteRepo.Revoke(tx, revokeInput.Id, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to revoke invite")
+	}
+
+	if !isRevoked {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Invite not found or already revoked")
+	}
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Revoke Room Invite")
+}
+
+// RedeemRoomInvite join the room using invite token without the room password
+func (h *RoomChatHandler) RedeemRoomInvite(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	redeemInput := new(models.RoomInviteRedeem)
+	if err := c.BodyParser(redeemInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(redeemInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Token":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Invite token is required")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	invite, err := h.roomInviteRepo.FindActiveByToken(tx, redeemInput.Token)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check invite")
+	}
+
+	if invite.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invite is invalid, expired or already used up")
+	}
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", invite.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isBanned, err := h.roomBanRepo.FindActiveBan(tx, user.Id, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room ban")
+	}
+
+	if isBanned {
+		return utils.ResponseError(c, fiber.StatusForbidden, "You are banned from this room")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	// already owner or member, so the invite is not used
+	if userRole != "" {
+		return utils.ResponseWithData(c, fiber.StatusOK, "You are already a member of this room", fiber.Map{
+			"room_code": roomCheck.RoomCode,
+		})
+	}
+
+	isUsed, err := h.roomInviteRepo.Use(tx, invite.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to use invite")
+	}
+
+	if !isUsed {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invite is invalid, expired or already used up")
+	}
+
+	newMember := models.RoomMember{
+		RoomId: roomCheck.Id,
+		UserId: user.Id,
+		Role:   invite.Role,
+	}
+	if err := h.roomMemberRepo.Create(tx, &newMember); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to join room")
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Join Room", fiber.Map{
+		"room_code": roomCheck.RoomCode,
+	})
+}
+
+// --- below for room join request related function ---
+
+// CreateJoinRequest ask to join room with approval join policy, owner and moderator of the room notified live
+func (h *RoomChatHandler) CreateJoinRequest(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	requestInput := new(models.RoomJoinRequestCreate)
+	if err := c.BodyParser(requestInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(requestInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "RoomId":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Room ID must be numeric and required")
+			case "Message":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Message must be less than 200 characters")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// notification only sent after the join request committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", requestInput.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomCheck.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	if roomCheck.JoinPolicy != models.JOIN_POLICY_APPROVAL {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "This room is not accepting join request")
+	}
+
+	isBanned, err := h.roomBanRepo.FindActiveBan(tx, user.Id, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room ban")
+	}
+
+	if isBanned {
+		return utils.ResponseError(c, fiber.StatusForbidden, "You are banned from this room")
+	}
+
+	userRole, err := permission.RoomRole(tx, &h.roomMemberRepo, roomCheck, user.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+	}
+
+	if userRole != "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "You are already a member of this room")
+	}
+
+	isPending, err := h.roomJoinRequestRepo.FindPendingByUserAndRoom(tx, user.Id, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check join request")
+	}
+
+	if isPending {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "You already have pending join request for this room")
+	}
+
+	joinRequest := models.RoomJoinRequest{
+		RoomId:  roomCheck.Id,
+		UserId:  user.Id,
+		Message: requestInput.Message,
+	}
+	if err = h.roomJoinRequestRepo.Create(tx, &joinRequest); err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to create join request")
+	}
+
+	// notify owner and moderator of the room
+	members, err := h.roomMemberRepo.FindByRoom(tx, roomCheck.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get room member list")
+	}
+
+	reviewerIds := []int{roomCheck.CreatedBy}
+	for _, member := range *members {
+		if permission.Can(member.Role, permission.ActionReviewJoin) {
+			reviewerIds = append(reviewerIds, member.UserId)
+		}
+	}
+
+	requestEvent := ws.JoinRequestEvent{
+		Id:       joinRequest.Id,
+		RoomCode: roomCheck.RoomCode,
+		RoomName: roomCheck.RoomName,
+		UserId:   user.Id,
+		Username: user.Username,
+		Message:  joinRequest.Message,
+		Status:   joinRequest.Status,
+	}
+	onCommit = append(onCommit, func() {
+		for _, reviewerId := range reviewerIds {
+			if err := h.wsManager.SendToUser(reviewerId, ws.EventJoinRequestCreated, requestEvent); err != nil {
+				log.Println("error send join request created: ", err)
+			}
+		}
+	})
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Send Join Request", fiber.Map{
+		"join_request": joinRequest,
+	})
+}
+
+// GetUserJoinRequestList get latest join request created by the user
+func (h *RoomChatHandler) GetUserJoinRequestList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	requests, err := h.roomJoinRequestRepo.FindByUser(tx, user.Id, 20)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get join request list")
+	}
+
+	if len(*requests) == 0 {
+		requests = &[]models.RoomJoinRequestShow{}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Join Request List", fiber.Map{
+		"join_requests": requests,
+	})
+}
+
+// GetRoomJoinRequestList get pending join request of the room, only for owner and moderator
+func (h *RoomChatHandler) GetRoomJoinRequestList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	roomCode := c.Params("room_code")
+	if roomCode == "" {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room Code is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	defer func() {
+		database.CommitOrRollback(tx, c, err)
+	}()
+
+	roomData, err := h.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	if roomData.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Room is not exist")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomData, user.Id, permission.ActionReviewJoin)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to see join request of this room")
+	}
+
+	requests, err := h.roomJoinRequestRepo.FindPendingByRoom(tx, roomData.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to get join request list")
+	}
+
+	if len(*requests) == 0 {
+		requests = &[]models.RoomJoinRequestShow{}
+	}
+
+	return utils.ResponseWithData(c, fiber.StatusOK, "Success Get Room Join Request List", fiber.Map{
+		"join_requests": requests,
+	})
+}
+
+// ReviewJoinRequest approve or reject pending join request, the requester notified live
+func (h *RoomChatHandler) ReviewJoinRequest(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserSession)
+
+	reviewInput := new(models.RoomJoinRequestReview)
+	if err := c.BodyParser(reviewInput); err != nil {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	if err := utils.ValidateStruct(reviewInput); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Id":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Join request ID must be numeric and required")
+			case "Reason":
+				return utils.ResponseError(c, fiber.StatusBadRequest, "Reason must be less than 200 characters")
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to start transaction")
+	}
+	// notification only sent after the join request committed
+	var onCommit []func()
+	defer func() {
+		database.CommitOrRollback(tx, c, err, onCommit...)
+	}()
+
+	joinRequest, err := h.roomJoinRequestRepo.FindById(tx, reviewInput.Id)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check join request")
+	}
+
+	if joinRequest.Id == 0 {
+		return utils.ResponseError(c, fiber.StatusNotFound, "Join request not found")
+	}
+
+	if joinRequest.Status != models.JOIN_REQUEST_PENDING {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Join request already reviewed")
+	}
+
+	roomCheck, err := h.roomChatRepo.FindByCodeOrAndId(tx, "", joinRequest.RoomId)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room")
+	}
+
+	isAllowed, err := permission.Check(tx, &h.roomMemberRepo, roomCheck, user.Id, permission.ActionReviewJoin)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user role")
+	}
+
+	if !isAllowed {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "You are not allowed to review join request of this room")
+	}
+
+	joinRequest.Status = models.JOIN_REQUEST_REJECTED
+	if reviewInput.Approve {
+		// user banned after sending the request can't be approved
+		isBanned, err := h.roomBanRepo.FindActiveBan(tx, joinRequest.UserId, roomCheck.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check room ban")
+		}
+
+		if isBanned {
+			return utils.ResponseError(c, fiber.StatusBadRequest, "User is banned from this room")
+		}
+
+		joinRequest.Status = models.JOIN_REQUEST_APPROVED
+	}
+	joinRequest.Reason = reviewInput.Reason
+	joinRequest.ReviewedBy = user.Id
+
+	isReviewed, err := h.roomJoinRequestRepo.Review(tx, &joinRequest.RoomJoinRequest)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to review join request")
+	}
+
+	if !isReviewed {
+		return utils.ResponseError(c, fiber.StatusBadRequest, "Join request already reviewed")
+	}
+
+	if reviewInput.Approve {
+		var exist bool
+		exist, err = h.roomMemberRepo.FindUserInRoom(tx, joinRequest.UserId, roomCheck.Id)
+		if err != nil {
+			return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to check user in room")
+		}
+
+		if !exist {
+			if err = h.roomMemberRepo.Create(tx, &models.RoomMember{
+				RoomId: roomCheck.Id,
+				UserId: joinRequest.UserId,
+			}); err != nil {
+				return utils.ResponseError(c, fiber.StatusInternalServerError, "Failed to add room member")
+			}
+		}
+	}
+
+	onCommit = append(onCommit, func() {
+		if err := h.wsManager.SendToUser(joinRequest.UserId, ws.EventJoinRequestReviewed, ws.JoinRequestEvent{
+			Id:       joinRequest.Id,
+			RoomCode: roomCheck.RoomCode,
+			RoomName: roomCheck.RoomName,
+			UserId:   joinRequest.UserId,
+			Username: joinRequest.Username,
+			Message:  joinRequest.Message,
+			Status:   joinRequest.Status,
+			Reason:   joinRequest.Reason,
+		}); err != nil {
+			log.Println("error send join request reviewed: ", err)
+		}
+	})
+
+	return utils.ResponseMessage(c, fiber.StatusOK, "Success Review Join Request")
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	sso_conn_room_reserved "github.com/momokii/go-sso-web/pkg/repository/conn_room_credit_reserved"
+	sso_user "github.com/momokii/go-sso-web/pkg/repository/user"
+	sso_credit_reserved "github.com/momokii/go-sso-web/pkg/repository/user_credit_reserved"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/llm"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	"github.com/momokii/simple-chat-app/internal/repository/mention"
+	"github.com/momokii/simple-chat-app/internal/repository/message"
+	messagereaction "github.com/momokii/simple-chat-app/internal/repository/message_reaction"
+	pinnedmessage "github.com/momokii/simple-chat-app/internal/repository/pinned_message"
+	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roomban "github.com/momokii/simple-chat-app/internal/repository/room_ban"
+	roominvite "github.com/momokii/simple-chat-app/internal/repository/room_invite"
+	roomjoinrequest "github.com/momokii/simple-chat-app/internal/repository/room_join_request"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	roomread "github.com/momokii/simple-chat-app/internal/repository/room_read"
+	"github.com/momokii/simple-chat-app/internal/repository/room_train"
+	roomtrainreport "github.com/momokii/simple-chat-app/internal/repository/room_train_report"
+	trainpersona "github.com/momokii/simple-chat-app/internal/repository/train_persona"
+	"github.com/momokii/simple-chat-app/internal/trainreport"
+	"github.com/momokii/simple-chat-app/internal/ws"
+	"github.com/momokii/simple-chat-app/pkg/utils"
+)
+
+// sso tables is owned by go-sso-web, only the column used by the sso repo created for the test
+const ssoTestSchema = `
+ALTER TABLE users ADD COLUMN credit_token INT DEFAULT 0, ADD COLUMN last_first_llm_used TIMESTAMP DEFAULT NULL;
+
+CREATE TYPE credit_status AS ENUM ('pending', 'confirmed', 'cancelled');
+CREATE TYPE feature_type AS ENUM ('chat-ai');
+
+CREATE TABLE user_credit_reserved (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credit INT NOT NULL,
+    feature_type feature_type NOT NULL,
+    status credit_status NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE room_credit_reserved_conn (
+    id SERIAL PRIMARY KEY,
+    room_code VARCHAR(255) NOT NULL REFERENCES room_chat_train(room_code) ON DELETE CASCADE,
+    user_credit_reserved_id INT NOT NULL REFERENCES user_credit_reserved(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+`
+
+const testUserId = 1
+
+type trainTestHandlers struct {
+	room            *RoomChatHandler
+	message         *MessageHandler
+	reportGenerator *trainreport.Generator
+}
+
+// newTrainTestHandlers build the train handler with the concrete repo (including sso repo) and the scripted LLM client
+func newTrainTestHandlers(llmClient llm.Client) trainTestHandlers {
+	manager := ws.NewManager(ws.ManagerConfig{Broadcaster: ws.NewLocalBroadcaster()}, room.RoomChatRepo{}, roommember.RoomMemberRepo{}, message.MessageRepo{}, roomread.RoomReadRepo{}, roomban.RoomBanRepo{}, mention.MentionRepo{}, attachment.AttachmentRepo{})
+	reportGenerator := trainreport.NewGenerator(room_train.RoomChatTrainRepo{}, message.MessageRepo{}, roomtrainreport.RoomTrainReportRepo{}, llmClient, manager)
+
+	return trainTestHandlers{
+		room:            NewRoomChatHandler(room.RoomChatRepo{}, room_train.RoomChatTrainRepo{}, roomtrainreport.RoomTrainReportRepo{}, reportGenerator, roommember.RoomMemberRepo{}, roomban.RoomBanRepo{}, roominvite.RoomInviteRepo{}, roomjoinrequest.RoomJoinRequestRepo{}, llmClient, sso_user.UserRepo{}, sso_credit_reserved.UserCreditReserved{}, sso_conn_room_reserved.ConnRoomCreditReserved{}, attachment.AttachmentRepo{}, pinnedmessage.PinnedMessageRepo{}, trainpersona.TrainPersonaRepo{}, nil, manager),
+		message:         NewMessageHandler(room.RoomChatRepo{}, message.MessageRepo{}, llmClient, room_train.RoomChatTrainRepo{}, roommember.RoomMemberRepo{}, messagereaction.MessageReactionRepo{}, mention.MentionRepo{}, attachment.AttachmentRepo{}, pinnedmessage.PinnedMessageRepo{}, nil, sso_credit_reserved.UserCreditReserved{}, reportGenerator, manager),
+		reportGenerator: reportGenerator,
+	}
+}
+
+// newTrainTestApp register the train route with the user session set like the auth middleware
+func newTrainTestApp(h trainTestHandlers) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", models.UserSession{Id: testUserId, Username: "tester"})
+		return c.Next()
+	})
+
+	app.Post("/api/rooms/train", h.room.CreateTrainRoom)
+	app.Post("/api/messages/train", h.message.SendMessageTrain)
+
+	return app
+}
+
+// setupTrainTestDB recreate the schema on TEST_DATABASE_URL, test skipped when the database is not set
+func setupTrainTestDB(t *testing.T) {
+	t.Helper()
+
+	dbUrl := os.Getenv("TEST_DATABASE_URL")
+	if dbUrl == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dbUrl)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema, err := os.ReadFile("../database/migrations/table.sql")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+
+	for _, query := range []string{"DROP SCHEMA public CASCADE; CREATE SCHEMA public;", string(schema), ssoTestSchema} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("setup schema: %v", err)
+		}
+	}
+
+	if _, err := db.Exec("INSERT INTO users (id, username, password, credit_token) VALUES ($1, 'tester', '-', 100)", testUserId); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	database.DB = db
+}
+
+func doJSON(t *testing.T, app *fiber.App, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request %s: %v", path, err)
+	}
+	defer res.Body.Close()
+
+	var resBody map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
+		t.Fatalf("decode response %s: %v", path, err)
+	}
+
+	return res.StatusCode, resBody
+}
+
+func TestSendMessageTrainValidation(t *testing.T) {
+	// invalid request rejected before the database used, so no database needed
+	app := newTrainTestApp(newTrainTestHandlers(llm.NewFake(nil, nil)))
+
+	status, _ := doJSON(t, app, "/api/messages/train", models.SendMessageLLMReq{RoomCode: "room-1", Content: "   "})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+}
+
+func TestTrainRoomSession(t *testing.T) {
+	setupTrainTestDB(t)
+
+	fake := llm.NewFake(
+		[]models.RoomChatTrainCreationRes{{
+			EmploymentType: "Barista",
+			Description:    "Suka ngobrol santai",
+			Hobby:          "Kopi dan musik",
+			Personality:    "Ramah",
+		}},
+		[]models.SendMessageLLMRes{
+			{ContinueChat: true, Content: "Halo juga, lagi ngapain?"},
+			{ContinueChat: false, Content: "Seru ngobrol sama kamu, sampai jumpa!"},
+		},
+	).WithReports([]models.RoomChatTrainReportRes{{
+		Engagement:     models.TrainReportAspect{Score: 7, Feedback: "Aktif"},
+		Humor:          models.TrainReportAspect{Score: 5, Feedback: "Cukup"},
+		QuestionAsking: models.TrainReportAspect{Score: 6, Feedback: "Baik"},
+		OverallScore:   6,
+		Summary:        "Percakapan berjalan baik",
+	}})
+	h := newTrainTestHandlers(fake)
+	app := newTrainTestApp(h)
+
+	status, body := doJSON(t, app, "/api/rooms/train", models.RoomChatTrainCreate{Gender: "female", Language: "indonesia", RangeAge: "25-30"})
+	if status != fiber.StatusOK {
+		t.Fatalf("create train room status = %d, body %v", status, body)
+	}
+
+	var roomId int
+	var roomCode string
+	var creditToken int
+	if err := database.DB.QueryRow("SELECT id, code FROM room_chat WHERE created_by = $1 AND is_train_room", testUserId).Scan(&roomId, &roomCode); err != nil {
+		t.Fatalf("get train room: %v", err)
+	}
+	if err := database.DB.QueryRow("SELECT credit_token FROM users WHERE id = $1", testUserId).Scan(&creditToken); err != nil {
+		t.Fatalf("get user credit: %v", err)
+	}
+	if creditToken != 100-utils.FEATURE_DATING_CHAT_SIMULATION_COST {
+		t.Fatalf("credit token = %d, want %d", creditToken, 100-utils.FEATURE_DATING_CHAT_SIMULATION_COST)
+	}
+
+	status, body = doJSON(t, app, "/api/messages/train", models.SendMessageLLMReq{RoomCode: roomCode, Content: "Halo!"})
+	if status != fiber.StatusOK {
+		t.Fatalf("first message status = %d, body %v", status, body)
+	}
+
+	// persona always loaded from the database and sent as the system prompt
+	calls := fake.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].Messages[0].Content, "Barista") {
+		t.Fatalf("persona not sent on the system prompt: %+v", calls)
+	}
+
+	status, body = doJSON(t, app, "/api/messages/train", models.SendMessageLLMReq{RoomCode: roomCode, Content: "Aku juga suka kopi"})
+	if status != fiber.StatusOK {
+		t.Fatalf("second message status = %d, body %v", status, body)
+	}
+
+	var totalMessage int
+	var isStillContinue bool
+	var reservedStatus string
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM messages m JOIN room_chat r ON r.id = m.room_id WHERE r.code = $1", roomCode).Scan(&totalMessage); err != nil {
+		t.Fatalf("count message: %v", err)
+	}
+	if err := database.DB.QueryRow("SELECT is_still_continue FROM room_chat_train WHERE room_code = $1", roomCode).Scan(&isStillContinue); err != nil {
+		t.Fatalf("get train status: %v", err)
+	}
+	if err := database.DB.QueryRow("SELECT ucr.status FROM user_credit_reserved ucr JOIN room_credit_reserved_conn rcrc ON rcrc.user_credit_reserved_id = ucr.id WHERE rcrc.room_code = $1", roomCode).Scan(&reservedStatus); err != nil {
+		t.Fatalf("get reserved credit: %v", err)
+	}
+
+	if totalMessage != 4 {
+		t.Fatalf("total message = %d, want 4", totalMessage)
+	}
+	if isStillContinue {
+		t.Fatal("train session still continue after the LLM end the conversation")
+	}
+	if reservedStatus != "confirmed" {
+		t.Fatalf("reserved credit status = %q, want confirmed", reservedStatus)
+	}
+
+	// ended session rejected before the LLM called
+	status, _ = doJSON(t, app, "/api/messages/train", models.SendMessageLLMReq{RoomCode: roomCode, Content: "Masih di sana?"})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("message after session ended status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+
+	// report generated in background after the session ended, Generate wait for the running generation
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := h.reportGenerator.Generate(ctx, &models.RoomChatDataShow{Id: roomId, RoomCode: roomCode})
+	if err != nil {
+		t.Fatalf("generate report: %v", err)
+	}
+	if report.Id == 0 || report.OverallScore != 6 {
+		t.Fatalf("report = %+v, want saved report with overall score 6", report)
+	}
+}
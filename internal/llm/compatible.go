@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const COMPATIBLE_REQUEST_TIMEOUT = 120 * time.Second
+
+// compatibleAPI call openai compatible chat completion endpoint directly with http, used by local endpoint and openai streaming
+type compatibleAPI struct {
+	url        string
+	model      string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+type compatibleCompletionReq struct {
+	Model          string                 `json:"model"`
+	Messages       []Message              `json:"messages"`
+	Stream         bool                   `json:"stream"`
+	ResponseFormat map[string]interface{} `json:"response_format,omitempty"`
+}
+
+type compatibleCompletionResp struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+// compatibleStreamChunk is one server sent event data of streamed completion
+type compatibleStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+func newCompatibleAPI(url, model string, headers map[string]string) *compatibleAPI {
+	return &compatibleAPI{
+		url:     url,
+		model:   model,
+		headers: headers,
+		httpClient: &http.Client{
+			Timeout: COMPATIBLE_REQUEST_TIMEOUT,
+		},
+	}
+}
+
+func (a *compatibleAPI) complete(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}) (string, error) {
+	resp, err := a.send(ctx, messages, schemaName, schema, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result compatibleCompletionResp
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if len(result.Choices) == 0 {
+		return "", ErrEmptyResponse
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+// stream send every content chunk to onChunk as soon as received and return the full content after the stream finished
+// context error returned when the stream cancelled
+func (a *compatibleAPI) stream(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}, onChunk func(chunk string) error) (string, error) {
+	resp, err := a.send(ctx, messages, schemaName, schema, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk compatibleStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", err
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onChunk(delta); err != nil {
+			return "", err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return content.String(), nil
+}
+
+func (a *compatibleAPI) send(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}, stream bool) (*http.Response, error) {
+	reqBody, err := json.Marshal(compatibleCompletionReq{
+		Model:    a.model,
+		Messages: messages,
+		Stream:   stream,
+		ResponseFormat: map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   schemaName,
+				"schema": schema,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range a.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// drain the body so the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("llm request failed: %s", resp.Status)
+	}
+
+	return resp, nil
+}
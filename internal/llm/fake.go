@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+// FakeClient is scripted LLM client without network, used on handler test
+// persona, reply and report returned in the scripted order and ErrScriptExhausted returned after the script is used up
+type FakeClient struct {
+	mu       sync.Mutex
+	personas []models.RoomChatTrainCreationRes
+	replies  []models.SendMessageLLMRes
+	reports  []models.RoomChatTrainReportRes
+	calls    []FakeCall
+}
+
+// FakeCall is the recorded ChatTrain request, so test can check the persona and history sent to the LLM
+type FakeCall struct {
+	Messages []Message
+}
+
+func NewFake(personas []models.RoomChatTrainCreationRes, replies []models.SendMessageLLMRes) *FakeClient {
+	return &FakeClient{
+		personas: personas,
+		replies:  replies,
+	}
+}
+
+func (f *FakeClient) GeneratePersona(ctx context.Context, base *models.RoomChatTrainCreate) (*models.RoomChatTrainCreationRes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.personas) == 0 {
+		return nil, ErrScriptExhausted
+	}
+
+	persona := f.personas[0]
+	f.personas = f.personas[1:]
+
+	return &persona, nil
+}
+
+func (f *FakeClient) ChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string) (*models.SendMessageLLMRes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{
+		Messages: TrainMessages(train, history, content),
+	})
+
+	if len(f.replies) == 0 {
+		return nil, ErrScriptExhausted
+	}
+
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+
+	return &reply, nil
+}
+
+// StreamChatTrain send the scripted reply content word by word to onDelta
+func (f *FakeClient) StreamChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string, onDelta func(delta string) error) (*models.SendMessageLLMRes, error) {
+	reply, err := f.ChatTrain(ctx, train, history, content)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, delta := range strings.SplitAfter(reply.Content, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if delta == "" {
+			continue
+		}
+
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	return reply, nil
+}
+
+// WithReports set the scripted coaching report returned by TrainReport
+func (f *FakeClient) WithReports(reports []models.RoomChatTrainReportRes) *FakeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reports = reports
+	return f
+}
+
+func (f *FakeClient) TrainReport(ctx context.Context, train *models.RoomChatTrain, history []models.Message) (*models.RoomChatTrainReportRes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.reports) == 0 {
+		return nil, ErrScriptExhausted
+	}
+
+	report := f.reports[0]
+	f.reports = f.reports[1:]
+	normalizeReport(&report)
+
+	return &report, nil
+}
+
+// Calls return every recorded ChatTrain request from the oldest
+func (f *FakeClient) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeCall{}, f.calls...)
+}
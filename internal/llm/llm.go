@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+var (
+	ErrEmptyResponse    = errors.New("llm response is empty")
+	ErrInvalidResponse  = errors.New("llm response is not valid json")
+	ErrScriptExhausted  = errors.New("fake llm script is exhausted")
+	ErrProviderNotFound = errors.New("llm provider is not supported")
+)
+
+// Client is the LLM provider used by train room, openai implemented first and openai compatible local endpoint (ollama/llama.cpp) can be used too
+// handler only depend on this interface, so the scripted fake can replace the real provider without network
+type Client interface {
+	// GeneratePersona create the persona detail (employment type, description, hobby and personality) from the basic train room data
+	GeneratePersona(ctx context.Context, base *models.RoomChatTrainCreate) (*models.RoomChatTrainCreationRes, error)
+	// ChatTrain reply the new user message as the persona, history is the saved conversation ordered from oldest to newest
+	ChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string) (*models.SendMessageLLMRes, error)
+	// StreamChatTrain same as ChatTrain but every new part of the reply content sent to onDelta while generated
+	// context error returned when the reply cancelled
+	StreamChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string, onDelta func(delta string) error) (*models.SendMessageLLMRes, error)
+	// TrainReport evaluate the whole ended session as dating coach, history is ordered from oldest to newest
+	TrainReport(ctx context.Context, train *models.RoomChatTrain, history []models.Message) (*models.RoomChatTrainReportRes, error)
+}
+
+// Message is one chat completion message, role is system, user or assistant
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// completer is the raw chat completion with json schema response, every real provider only need to implement this
+// and share the prompt through generatePersona and chatTrain
+type completer interface {
+	complete(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}) (string, error)
+}
+
+// streamer is the streamed chat completion, onChunk receive the raw response chunk
+type streamer interface {
+	stream(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}, onChunk func(chunk string) error) (string, error)
+}
+
+// decodeJSON parse the json response, local model sometimes wrap the json on markdown code block so it is removed first
+func decodeJSON(content string, v interface{}) error {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(content, "```")
+		content = strings.TrimSpace(content)
+	}
+
+	if content == "" {
+		return ErrEmptyResponse
+	}
+
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
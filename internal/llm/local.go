@@ -0,0 +1,52 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+const DEFAULT_LOCAL_BASE_URL = "http://localhost:11434/v1"
+
+// LocalClient use openai compatible chat completion endpoint, like ollama (http://localhost:11434/v1) or llama.cpp server (http://localhost:8080/v1)
+// api key is optional because most local server don't use it
+type LocalClient struct {
+	api *compatibleAPI
+}
+
+func NewLocal(baseUrl, model, apiKey string) (*LocalClient, error) {
+	if model == "" {
+		return nil, errors.New("model is required for local llm")
+	}
+
+	if baseUrl == "" {
+		baseUrl = DEFAULT_LOCAL_BASE_URL
+	}
+
+	headers := map[string]string{}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+
+	return &LocalClient{
+		api: newCompatibleAPI(strings.TrimSuffix(baseUrl, "/")+"/chat/completions", model, headers),
+	}, nil
+}
+
+func (c *LocalClient) GeneratePersona(ctx context.Context, base *models.RoomChatTrainCreate) (*models.RoomChatTrainCreationRes, error) {
+	return generatePersona(ctx, c.api, base)
+}
+
+func (c *LocalClient) ChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string) (*models.SendMessageLLMRes, error) {
+	return chatTrain(ctx, c.api, train, history, content)
+}
+
+func (c *LocalClient) StreamChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string, onDelta func(delta string) error) (*models.SendMessageLLMRes, error) {
+	return streamChatTrain(ctx, c.api, train, history, content, onDelta)
+}
+
+func (c *LocalClient) TrainReport(ctx context.Context, train *models.RoomChatTrain, history []models.Message) (*models.RoomChatTrainReportRes, error) {
+	return trainReport(ctx, c.api, train, history)
+}
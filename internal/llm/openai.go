@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/momokii/go-llmbridge/pkg/openai"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+const DEFAULT_OPENAI_MODEL = "gpt-4o-mini"
+
+// OpenAIClient use openai chat completion through go-llmbridge
+// go-llmbridge don't support streaming, so streaming call the chat completion endpoint directly
+type OpenAIClient struct {
+	client    openai.OpenAI
+	streamAPI *compatibleAPI
+}
+
+func NewOpenAI(apiKey, organization, project, model string) (*OpenAIClient, error) {
+	if model == "" {
+		model = DEFAULT_OPENAI_MODEL
+	}
+
+	client, err := openai.New(apiKey, organization, project, openai.WithModel(model))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"Authorization": "Bearer " + apiKey,
+	}
+	if organization != "" {
+		headers["OpenAI-Organization"] = organization
+	}
+	if project != "" {
+		headers["OpenAI-Project"] = project
+	}
+
+	return &OpenAIClient{
+		client:    client,
+		streamAPI: newCompatibleAPI(openai.OAUrlTextCompletions, model, headers),
+	}, nil
+}
+
+func (c *OpenAIClient) GeneratePersona(ctx context.Context, base *models.RoomChatTrainCreate) (*models.RoomChatTrainCreationRes, error) {
+	return generatePersona(ctx, c, base)
+}
+
+func (c *OpenAIClient) ChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string) (*models.SendMessageLLMRes, error) {
+	return chatTrain(ctx, c, train, history, content)
+}
+
+func (c *OpenAIClient) StreamChatTrain(ctx context.Context, train *models.RoomChatTrain, history []models.Message, content string, onDelta func(delta string) error) (*models.SendMessageLLMRes, error) {
+	return streamChatTrain(ctx, c.streamAPI, train, history, content, onDelta)
+}
+
+func (c *OpenAIClient) TrainReport(ctx context.Context, train *models.RoomChatTrain, history []models.Message) (*models.RoomChatTrainReportRes, error) {
+	return trainReport(ctx, c, train, history)
+}
+
+// complete go-llmbridge don't support context, so context only checked before the request sent
+func (c *OpenAIClient) complete(ctx context.Context, messages []Message, schemaName string, schema map[string]interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	reqMessages := make([]openai.OAMessageReq, 0, len(messages))
+	for _, message := range messages {
+		reqMessages = append(reqMessages, openai.OAMessageReq{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+
+	responseFormat := openai.OACreateResponseFormat(schemaName, schema)
+
+	response, err := c.client.OpenAISendMessage(&reqMessages, true, &responseFormat, false, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if len(response.Choices) == 0 {
+		return "", ErrEmptyResponse
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var contentKeyRegex = regexp.MustCompile(`"content"\s*:\s*"`)
+
+// contentExtractor decode the "content" string value from the streamed json response while it still generated
+// incomplete escape sequence or utf-8 character at the end of the chunk held until the next chunk received
+type contentExtractor struct {
+	raw     strings.Builder
+	started bool
+	done    bool
+	// pos is the next raw index to decode inside the content value
+	pos int
+}
+
+// write add the raw chunk and return the new decoded content, empty string if nothing new
+func (e *contentExtractor) write(chunk string) string {
+	e.raw.WriteString(chunk)
+	if e.done {
+		return ""
+	}
+
+	raw := e.raw.String()
+	if !e.started {
+		loc := contentKeyRegex.FindStringIndex(raw)
+		if loc == nil {
+			return ""
+		}
+		e.started = true
+		e.pos = loc[1]
+	}
+
+	var delta strings.Builder
+	for e.pos < len(raw) {
+		ch := raw[e.pos]
+
+		// closing quote, the content value is finished
+		if ch == '"' {
+			e.done = true
+			break
+		}
+
+		if ch != '\\' {
+			if !utf8.FullRuneInString(raw[e.pos:]) {
+				break
+			}
+			_, size := utf8.DecodeRuneInString(raw[e.pos:])
+			delta.WriteString(raw[e.pos : e.pos+size])
+			e.pos += size
+			continue
+		}
+
+		seqLen := 2
+		if e.pos+1 < len(raw) && raw[e.pos+1] == 'u' {
+			seqLen = 6
+			// high surrogate need the low surrogate escape too
+			if e.pos+6 <= len(raw) {
+				if code, err := strconv.ParseUint(raw[e.pos+2:e.pos+6], 16, 16); err == nil && code >= 0xD800 && code < 0xDC00 {
+					seqLen = 12
+				}
+			}
+		}
+
+		if e.pos+seqLen > len(raw) {
+			break
+		}
+
+		var decoded string
+		if err := json.Unmarshal([]byte(`"`+raw[e.pos:e.pos+seqLen]+`"`), &decoded); err != nil {
+			// invalid escape, stop streaming and let the final response decide the content
+			e.done = true
+			break
+		}
+		delta.WriteString(decoded)
+		e.pos += seqLen
+	}
+
+	return delta.String()
+}
@@ -0,0 +1,81 @@
+package mention
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+	mentionrepo "github.com/momokii/simple-chat-app/internal/repository/mention"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+)
+
+// mention pattern is @username, username not preceded by word character so email address not counted as mention
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]{1,25})`)
+
+// Parse get unique mentioned username (lower case) from message content
+func Parse(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// trailing dot or dash is punctuation of the sentence, e.g. "thanks @john."
+		username := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		if username == "" || seen[username] {
+			continue
+		}
+
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+
+	return usernames
+}
+
+// Create parse mention on the message and save the mention for mentioned room member (include room owner)
+// sender mentioning themself is ignored, return the saved mention
+func Create(tx *sql.Tx, memberRepo *roommember.RoomMemberRepo, mentionRepo *mentionrepo.MentionRepo, room *models.RoomChatDataShow, message *models.Message) ([]models.Mention, error) {
+	var mentions []models.Mention
+
+	usernames := Parse(message.Content)
+	if len(usernames) == 0 {
+		return mentions, nil
+	}
+
+	members, err := memberRepo.FindByRoom(tx, room.Id)
+	if err != nil {
+		return mentions, err
+	}
+
+	// room owner is not stored on room member
+	roomUsers := map[string]int{
+		strings.ToLower(room.Username): room.CreatedBy,
+	}
+	for _, member := range *members {
+		roomUsers[strings.ToLower(member.Username)] = member.UserId
+	}
+
+	for _, username := range usernames {
+		userId, ok := roomUsers[username]
+		if !ok || userId == message.SenderId {
+			continue
+		}
+
+		mention := models.Mention{
+			MessageId: message.Id,
+			RoomId:    room.Id,
+			UserId:    userId,
+			SenderId:  message.SenderId,
+		}
+		isCreated, err := mentionRepo.Create(tx, &mention)
+		if err != nil {
+			return mentions, err
+		}
+
+		if isCreated {
+			mentions = append(mentions, mention)
+		}
+	}
+
+	return mentions, nil
+}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"log"
 	"os"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/momokii/simple-chat-app/internal/models"
 	sessionRepo "github.com/momokii/simple-chat-app/internal/repository/session"
 	"github.com/momokii/simple-chat-app/internal/repository/user"
+	"github.com/momokii/simple-chat-app/pkg/utils"
 )
 
 var (
@@ -84,29 +86,26 @@ func IsNotAuth(c *fiber.Ctx) error {
 	return c.Next()
 }
 
-func IsAuth(c *fiber.Ctx) error {
+// GetUserSession resolve the session_id_gochat cookie into the user data, the session is checked to the database so deleted/expired session will be rejected
+func GetUserSession(c *fiber.Ctx) (*models.UserSession, error) {
 	userid, err := CheckSession(c, "id")
 	if err != nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, err
 	}
 
 	session_id, err := CheckSession(c, "session_id")
 	if err != nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, err
 	}
 
-	// if session data not found, redirect to login
+	// if session data not found
 	if userid == nil || session_id == nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, errors.New("session not found")
 	}
 
 	tx, err := database.DB.Begin()
 	if err != nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, err
 	}
 	defer func() {
 		database.CommitOrRollback(tx, c, err)
@@ -118,33 +117,51 @@ func IsAuth(c *fiber.Ctx) error {
 
 	// first check if session is valid on database
 	sessData, err := session_repo.FindSession(tx, session_id.(string), userid.(int))
-	// if session not found or error happen, redirect to login and delete the session local data
 	if err != nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, err
 	}
 
 	// if session is deleted/ not found
 	if sessData.Id == 0 && sessData.UserId == 0 && sessData.SessionId == "" {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, errors.New("session not found")
 	}
 
 	userData, err := userRepo.FindByID(tx, userid.(int))
 	if err != nil {
-		DeleteSession(c)
-		return c.Redirect(SSO_URL)
+		return nil, err
 	}
 
-	userSession := models.UserSession{
+	return &models.UserSession{
 		Id:               userData.Id,
 		Username:         userData.Username,
 		CreditToken:      userData.CreditToken,
 		LastFirstLLMUsed: userData.LastFirstLLMUsed,
+	}, nil
+}
+
+func IsAuth(c *fiber.Ctx) error {
+	userSession, err := GetUserSession(c)
+	// if session not found or error happen, redirect to login and delete the session local data
+	if err != nil {
+		DeleteSession(c)
+		return c.Redirect(SSO_URL)
 	}
 
 	// store information for next data
-	c.Locals("user", userSession)
+	c.Locals("user", *userSession)
+
+	return c.Next()
+}
+
+// IsWSAuth same with IsAuth but used for websocket upgrade request, because websocket client can't follow redirect so just return unauthorized response
+func IsWSAuth(c *fiber.Ctx) error {
+	userSession, err := GetUserSession(c)
+	if err != nil {
+		return utils.ResponseError(c, fiber.StatusUnauthorized, "Unauthorized, please login first")
+	}
+
+	// store information for next data, the value will also available on net/http request context (r.Context().Value("user")) when using adaptor
+	c.Locals("user", *userSession)
 
 	return c.Next()
 }
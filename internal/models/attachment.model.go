@@ -0,0 +1,50 @@
+package models
+
+import "strconv"
+
+const (
+	// url of attachment file, thumbnail url is ATTACHMENT_URL_PREFIX + id + ATTACHMENT_THUMBNAIL_SUFFIX
+	ATTACHMENT_URL_PREFIX       = "/api/attachments/"
+	ATTACHMENT_THUMBNAIL_SUFFIX = "/thumbnail"
+)
+
+type Attachment struct {
+	Id           int    `json:"id"`
+	RoomId       int    `json:"room_id" validate:"required"`
+	MessageId    int    `json:"message_id"` // 0 until the attachment sent with message
+	UploadedBy   int    `json:"uploaded_by" validate:"required"`
+	FileName     string `json:"file_name" validate:"required,max=255"`
+	MimeType     string `json:"mime_type" validate:"required"`
+	Size         int64  `json:"size"`
+	IsImage      bool   `json:"is_image"`
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"` // empty if the thumbnail is not available
+	CreatedAt    string `json:"created_at"`
+}
+
+// AttachmentShow is attachment data showed on message, file only can be downloaded by room member through the url
+type AttachmentShow struct {
+	Id           int    `json:"id"`
+	FileName     string `json:"file_name"`
+	MimeType     string `json:"mime_type"`
+	Size         int64  `json:"size"`
+	IsImage      bool   `json:"is_image"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnail_url"` // empty if the thumbnail is not available
+}
+
+func (a *Attachment) Show() AttachmentShow {
+	attachment := AttachmentShow{
+		Id:       a.Id,
+		FileName: a.FileName,
+		MimeType: a.MimeType,
+		Size:     a.Size,
+		IsImage:  a.IsImage,
+		Url:      ATTACHMENT_URL_PREFIX + strconv.Itoa(a.Id),
+	}
+	if a.ThumbnailKey != "" {
+		attachment.ThumbnailUrl = attachment.Url + ATTACHMENT_THUMBNAIL_SUFFIX
+	}
+
+	return attachment
+}
@@ -0,0 +1,31 @@
+package models
+
+type DirectRoom struct {
+	Id        int    `json:"id"`
+	RoomId    int    `json:"room_id" validate:"required"`
+	UserOneId int    `json:"user_one_id" validate:"required"`
+	UserTwoId int    `json:"user_two_id" validate:"required"`
+	CreatedAt string `json:"created_at"`
+}
+
+type DirectLastMessage struct {
+	Id        int    `json:"id"`
+	SenderId  int    `json:"sender_id"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	Deleted   bool   `json:"deleted"`
+}
+
+type DirectRoomShow struct {
+	RoomId      int                `json:"room_id"`
+	RoomCode    string             `json:"room_code"`
+	UserId      int                `json:"user_id"` // the other user of the conversation
+	Username    string             `json:"username"`
+	LastMessage *DirectLastMessage `json:"last_message"` // nil if there is no message yet
+	UnreadCount int                `json:"unread_count"`
+	CreatedAt   string             `json:"created_at"`
+}
+
+type DirectRoomCreate struct {
+	Username string `json:"username" validate:"required,max=25"`
+}
@@ -0,0 +1,25 @@
+package models
+
+type Mention struct {
+	Id        int    `json:"id"`
+	MessageId int    `json:"message_id" validate:"required"`
+	RoomId    int    `json:"room_id" validate:"required"`
+	UserId    int    `json:"user_id" validate:"required"`
+	SenderId  int    `json:"sender_id" validate:"required"`
+	ReadAt    string `json:"read_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+type MentionShow struct {
+	Mention
+	RoomCode       string `json:"room_code"`
+	RoomName       string `json:"room_name"`
+	SenderUsername string `json:"sender_username"`
+	Content        string `json:"content"`
+}
+
+// MentionRead mark mention as read by id, or all unread mention of the user when all is true
+type MentionRead struct {
+	Ids []int `json:"ids" validate:"required_without=All,max=100,dive,min=1"`
+	All bool  `json:"all"`
+}
@@ -1,30 +1,70 @@
 package models
 
+const (
+	// max length of chat message content, same as the train room message
+	MESSAGE_MAX_LENGTH = TRAIN_MESSAGE_MAX_LENGTH
+)
+
 type Message struct {
 	Id        int    `json:"id" validate:"required"`
 	RoomId    int    `json:"room_id" validate:"required"`
 	SenderId  int    `json:"sender_id" validate:"required"`
 	Content   string `json:"content" validate:"required,min=1,max=140"`
 	CreatedAt string `json:"created_at" validate:"required"`
+	EditedAt  string `json:"edited_at"`
+	Deleted   bool   `json:"deleted"`
+	ParentId  int    `json:"parent_id"` // 0 if the message is not a thread reply
 }
 
 type MessageShow struct {
 	Id             int    `json:"id" validate:"required"`
 	RoomId         int    `json:"room_id" validate:"required"`
+	SenderId       int    `json:"sender_id"`
 	SenderUsername string `json:"sender_username" validate:"required"`
 	Content        string `json:"content" validate:"required,min=1,max=140"`
 	CreatedAt      string `json:"created_at" validate:"required"`
+	EditedAt       string `json:"edited_at"`
+	Deleted        bool   `json:"deleted"`
+	ParentId       int    `json:"parent_id"`
+	// Parent is short preview of the replied message, nil if the message is not a thread reply
+	Parent      *MessageParentShow       `json:"parent"`
+	ReplyCount  int                      `json:"reply_count"`
+	Reactions   []MessageReactionSummary `json:"reactions"`
+	Attachments []AttachmentShow         `json:"attachments"`
+}
+
+// MessageParentShow is the replied message preview, content is empty when the parent already deleted
+type MessageParentShow struct {
+	Id             int    `json:"id"`
+	RoomId         int    `json:"room_id"`
+	SenderId       int    `json:"sender_id"`
+	SenderUsername string `json:"sender_username"`
+	Content        string `json:"content"`
+	Deleted        bool   `json:"deleted"`
 }
 
+// MessageCreate content can be empty when the message have attachment
 type MessageCreate struct {
-	RoomCode string `json:"room_code" validate:"required"`
-	SenderId int    `json:"sender_id" validate:"required"`
-	Content  string `json:"content" validate:"required,min=1"`
+	RoomCode      string `json:"room_code" validate:"required"`
+	SenderId      int    `json:"sender_id" validate:"required"`
+	Content       string `json:"content" validate:"required_without=AttachmentIds,max=1000"`
+	ParentId      int    `json:"parent_id" validate:"omitempty,min=1"`
+	AttachmentIds []int  `json:"attachment_ids" validate:"max=10,dive,min=1"`
+}
+
+type MessageEdit struct {
+	Id      int    `json:"id" validate:"required"`
+	Content string `json:"content" validate:"required,min=1,max=1000"`
+}
+
+type MessageDelete struct {
+	Id int `json:"id" validate:"required"`
 }
 
-type MessageLLMCreate struct {
-	RoomCode   string `json:"room_code" validate:"required"`
-	SenderId   int    `json:"sender_id" validate:"required"`
-	Content    string `json:"content" validate:"required,min=1"`
-	LLMContent string `json:"llm_content" validate:"required,min=1"`
+type MessageSearchShow struct {
+	MessageShow
+	RoomCode string `json:"room_code"`
+	RoomName string `json:"room_name"`
+	// Snippet is html escaped content with matched word wrapped on <mark> tag, safe to be rendered as html
+	Snippet string `json:"snippet"`
 }
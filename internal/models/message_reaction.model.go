@@ -0,0 +1,26 @@
+package models
+
+const (
+	REACTION_ADDED   = "added"
+	REACTION_REMOVED = "removed"
+)
+
+type MessageReaction struct {
+	Id        int    `json:"id"`
+	MessageId int    `json:"message_id" validate:"required"`
+	UserId    int    `json:"user_id" validate:"required"`
+	Emoji     string `json:"emoji" validate:"required,max=32"`
+	CreatedAt string `json:"created_at"`
+}
+
+// MessageReactionSummary is aggregated reaction of the message for every emoji
+type MessageReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+type MessageReactionInput struct {
+	MessageId int    `json:"message_id" validate:"required"`
+	Emoji     string `json:"emoji" validate:"required,max=32"`
+}
@@ -0,0 +1,30 @@
+package models
+
+const (
+	PIN_ADDED   = "pinned"
+	PIN_REMOVED = "unpinned"
+
+	// maximum pinned message in one room
+	MAX_PINNED_MESSAGE = 20
+)
+
+type PinnedMessage struct {
+	Id        int    `json:"id"`
+	RoomId    int    `json:"room_id" validate:"required"`
+	MessageId int    `json:"message_id" validate:"required"`
+	PinnedBy  int    `json:"pinned_by" validate:"required"`
+	CreatedAt string `json:"created_at"`
+}
+
+type PinnedMessageShow struct {
+	PinnedMessage
+	PinnedByUsername string `json:"pinned_by_username"`
+	SenderId         int    `json:"sender_id"`
+	SenderUsername   string `json:"sender_username"`
+	Content          string `json:"content"`
+	MessageCreatedAt string `json:"message_created_at"`
+}
+
+type MessagePin struct {
+	MessageId int `json:"message_id" validate:"required"`
+}
@@ -1,5 +1,13 @@
 package models
 
+// join policy of the room, enforced when user join the room
+const (
+	JOIN_POLICY_OPEN        = "open"
+	JOIN_POLICY_PASSWORD    = "password"
+	JOIN_POLICY_APPROVAL    = "approval"
+	JOIN_POLICY_INVITE_ONLY = "invite_only"
+)
+
 type RoomChat struct {
 	Id          int    `json:"id" validate:"required"`
 	RoomCode    string `json:"room_code" validate:"required"`
@@ -9,14 +17,21 @@ type RoomChat struct {
 	Password    string `json:"password"`
 	IsPrivate   bool   `json:"is_private"`
 	IsTrainRoom bool   `json:"is_train_room"`
-	CreatedAt   string `json:"created_at" validate:"required"`
-	UpdatedAt   string `json:"updated_at" validate:"required"`
+	JoinPolicy  string `json:"join_policy"`
+	IsDirect    bool   `json:"is_direct"`
+	// announcement room is read-only for regular member, only owner and moderator can post
+	IsAnnouncement bool   `json:"is_announcement"`
+	CreatedAt      string `json:"created_at" validate:"required"`
+	UpdatedAt      string `json:"updated_at" validate:"required"`
 }
 type RoomChatCreate struct {
 	RoomName    string `json:"room_name" validate:"required,min=1,max=30"`
 	Description string `json:"description" validate:"required,min=1,max=140"`
 	Password    string `json:"password" validate:"min=4,max=30,alphanum"`
 	IsPrivate   bool   `json:"is_private"`
+	// JoinPolicy empty will follow IsPrivate (password if private, open if not)
+	JoinPolicy     string `json:"join_policy" validate:"omitempty,oneof=open password approval invite_only"`
+	IsAnnouncement bool   `json:"is_announcement"`
 }
 
 type RoomChatEdit struct {
@@ -30,14 +45,18 @@ type RoomChatDelete struct {
 }
 
 type RoomChatDataShow struct {
-	Id          int    `json:"id" validate:"required"`
-	RoomCode    string `json:"room_code" validate:"required"`
-	CreatedBy   int    `json:"created_by" validate:"required"`
-	Username    string `json:"username" validate:"required"`
-	RoomName    string `json:"room_name" validate:"required,min=1,max=30"`
-	Description string `json:"description" validate:"required,min=1,max=140"`
-	IsPrivate   bool   `json:"is_private"`
-	IsTrainRoom bool   `json:"is_train_room"`
-	Password    string `json:"password"`
-	CreatedAt   string `json:"created_at" validate:"required"`
+	Id             int    `json:"id" validate:"required"`
+	RoomCode       string `json:"room_code" validate:"required"`
+	CreatedBy      int    `json:"created_by" validate:"required"`
+	Username       string `json:"username" validate:"required"`
+	RoomName       string `json:"room_name" validate:"required,min=1,max=30"`
+	Description    string `json:"description" validate:"required,min=1,max=140"`
+	IsPrivate      bool   `json:"is_private"`
+	IsTrainRoom    bool   `json:"is_train_room"`
+	Password       string `json:"password"`
+	JoinPolicy     string `json:"join_policy"`
+	IsDirect       bool   `json:"is_direct"`
+	IsAnnouncement bool   `json:"is_announcement"`
+	CreatedAt      string `json:"created_at" validate:"required"`
+	UnreadCount    int    `json:"unread_count"`
 }
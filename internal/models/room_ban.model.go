@@ -0,0 +1,34 @@
+package models
+
+type RoomBan struct {
+	Id        int    `json:"id"`
+	RoomId    int    `json:"room_id" validate:"required"`
+	UserId    int    `json:"user_id" validate:"required"`
+	BannedBy  int    `json:"banned_by" validate:"required"`
+	Reason    string `json:"reason"`
+	ExpiresAt string `json:"expires_at"` // empty mean permanent ban
+	CreatedAt string `json:"created_at"`
+}
+
+type RoomBanShow struct {
+	RoomBan
+	Username         string `json:"username"`
+	BannedByUsername string `json:"banned_by_username"`
+}
+
+type RoomMemberKick struct {
+	RoomId int    `json:"room_id" validate:"required"`
+	UserId int    `json:"user_id" validate:"required"`
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+type RoomMemberBan struct {
+	RoomMemberKick
+	// Duration is ban duration in minutes, 0 mean permanent ban
+	Duration int `json:"duration" validate:"min=0,max=525600"`
+}
+
+type RoomMemberUnban struct {
+	RoomId int `json:"room_id" validate:"required"`
+	UserId int `json:"user_id" validate:"required"`
+}
@@ -0,0 +1,37 @@
+package models
+
+type RoomInvite struct {
+	Id        int    `json:"id"`
+	RoomId    int    `json:"room_id" validate:"required"`
+	Token     string `json:"token" validate:"required"`
+	CreatedBy int    `json:"created_by" validate:"required"`
+	Role      string `json:"role"`
+	MaxUses   int    `json:"max_uses"` // 0 mean unlimited
+	UsedCount int    `json:"used_count"`
+	ExpiresAt string `json:"expires_at"` // empty mean never expired
+	RevokedAt string `json:"revoked_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+type RoomInviteShow struct {
+	RoomInvite
+	CreatedByUsername string `json:"created_by_username"`
+	IsActive          bool   `json:"is_active"`
+}
+
+type RoomInviteCreate struct {
+	RoomId  int    `json:"room_id" validate:"required"`
+	Role    string `json:"role" validate:"omitempty,oneof=moderator member"`
+	MaxUses int    `json:"max_uses" validate:"min=0,max=1000"`
+	// Duration is invite valid duration in minutes, 0 mean never expired
+	Duration int `json:"duration" validate:"min=0,max=525600"`
+}
+
+type RoomInviteRevoke struct {
+	Id     int `json:"id" validate:"required"`
+	RoomId int `json:"room_id" validate:"required"`
+}
+
+type RoomInviteRedeem struct {
+	Token string `json:"token" validate:"required,max=32"`
+}
@@ -0,0 +1,37 @@
+package models
+
+const (
+	JOIN_REQUEST_PENDING  = "pending"
+	JOIN_REQUEST_APPROVED = "approved"
+	JOIN_REQUEST_REJECTED = "rejected"
+)
+
+type RoomJoinRequest struct {
+	Id         int    `json:"id"`
+	RoomId     int    `json:"room_id" validate:"required"`
+	UserId     int    `json:"user_id" validate:"required"`
+	Message    string `json:"message"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason"`
+	ReviewedBy int    `json:"reviewed_by"`
+	CreatedAt  string `json:"created_at"`
+	ReviewedAt string `json:"reviewed_at"`
+}
+
+type RoomJoinRequestShow struct {
+	RoomJoinRequest
+	Username string `json:"username"`
+	RoomCode string `json:"room_code"`
+	RoomName string `json:"room_name"`
+}
+
+type RoomJoinRequestCreate struct {
+	RoomId  int    `json:"room_id" validate:"required"`
+	Message string `json:"message" validate:"max=200"`
+}
+
+type RoomJoinRequestReview struct {
+	Id      int    `json:"id" validate:"required"`
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason" validate:"max=200"`
+}
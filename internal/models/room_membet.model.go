@@ -1,9 +1,17 @@
 package models
 
+// room role, owner is the room creator and not stored on room_members
+const (
+	ROOM_ROLE_OWNER     = "owner"
+	ROOM_ROLE_MODERATOR = "moderator"
+	ROOM_ROLE_MEMBER    = "member"
+)
+
 type RoomMember struct {
 	Id        int    `json:"id" validate:"required"`
 	RoomId    int    `json:"room_id" validate:"required"`
 	UserId    int    `json:"user_id" validate:"required"`
+	Role      string `json:"role"`
 	CreatedAt string `json:"created_at" validate:"required"`
 }
 
@@ -17,3 +25,9 @@ type RoomMemberCreate struct {
 	// just case need password field because we need password for the private room chat
 	Password string `json:"password" validate:"min=4,max=30"`
 }
+
+type RoomMemberRoleUpdate struct {
+	RoomId int    `json:"room_id" validate:"required"`
+	UserId int    `json:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required,oneof=moderator member"`
+}
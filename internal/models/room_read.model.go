@@ -0,0 +1,9 @@
+package models
+
+type RoomRead struct {
+	Id                int    `json:"id"`
+	RoomId            int    `json:"room_id" validate:"required"`
+	UserId            int    `json:"user_id" validate:"required"`
+	LastReadMessageId int    `json:"last_read_message_id" validate:"required"`
+	UpdatedAt         string `json:"updated_at"`
+}
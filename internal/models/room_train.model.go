@@ -1,6 +1,16 @@
 package models
 
-import "github.com/momokii/go-llmbridge/pkg/openai"
+const (
+	// max length of user message on train room
+	TRAIN_MESSAGE_MAX_LENGTH = 1000
+	// max latest message used as conversation history for LLM
+	TRAIN_HISTORY_LIMIT = 100
+	// max latest message of the session evaluated on coaching report
+	TRAIN_REPORT_MESSAGE_LIMIT = 300
+	// score range of every report aspect and the overall report score
+	TRAIN_REPORT_ASPECT_MAX_SCORE  = 10
+	TRAIN_REPORT_OVERALL_MAX_SCORE = 100
+)
 
 type RoomChatTrain struct {
 	Id              int    `json:"id" validate:"required"`
@@ -22,18 +32,58 @@ type RoomChatTrainCreationRes struct {
 	Personality    string `json:"personality" validate:"required"`
 }
 
+// RoomChatTrainCreate create train room from saved persona (persona_id) or from the basic data
+// persona detail edited by user is used as is, LLM only generate the detail when every detail field is empty
 type RoomChatTrainCreate struct {
-	Gender   string `json:"gender" validate:"required"`
-	RangeAge string `json:"range_age" validate:"required"`
-	Language string `json:"language" validate:"required"`
+	PersonaId      int    `json:"persona_id" validate:"omitempty,min=1"`
+	Gender         string `json:"gender" validate:"required_without=PersonaId,omitempty,oneof=male female"`
+	RangeAge       string `json:"range_age" validate:"required_without=PersonaId,omitempty,oneof=18-24 25-30 31-40 41-50"`
+	Language       string `json:"language" validate:"required_without=PersonaId,omitempty,oneof=indonesia english"`
+	EmploymentType string `json:"employment_type" validate:"omitempty,max=100,persona_text"`
+	Description    string `json:"description" validate:"omitempty,max=300,persona_text"`
+	Hobby          string `json:"hobby" validate:"omitempty,max=200,persona_text"`
+	Personality    string `json:"personality" validate:"omitempty,max=200,persona_text"`
 }
 
+// RoomChatTrainPersonaGenerate generate persona detail preview, so user can edit it before the train room created
+type RoomChatTrainPersonaGenerate struct {
+	Gender   string `json:"gender" validate:"required,oneof=male female"`
+	RangeAge string `json:"range_age" validate:"required,oneof=18-24 25-30 31-40 41-50"`
+	Language string `json:"language" validate:"required,oneof=indonesia english"`
+}
+
+// SendMessageLLMReq only contain the new user message, persona and history loaded from database
 type SendMessageLLMReq struct {
-	TrainerData RoomChatTrain         `json:"trainer_data" validate:"required"`
-	Messages    []openai.OAMessageReq `json:"messages" validate:"required"`
+	RoomCode string `json:"room_code" validate:"required"`
+	Content  string `json:"content" validate:"required,max=1000"`
 }
 
 type SendMessageLLMRes struct {
 	ContinueChat bool   `json:"continue_chat"`
 	Content      string `json:"content"`
 }
+
+// TrainReportAspect is one evaluated aspect of the session, score from 1 to TRAIN_REPORT_ASPECT_MAX_SCORE
+type TrainReportAspect struct {
+	Score    int    `json:"score"`
+	Feedback string `json:"feedback"`
+}
+
+// RoomChatTrainReportRes is the coaching report generated by LLM from the whole session transcript
+type RoomChatTrainReportRes struct {
+	Engagement     TrainReportAspect `json:"engagement"`
+	Humor          TrainReportAspect `json:"humor"`
+	QuestionAsking TrainReportAspect `json:"question_asking"`
+	RedFlags       []string          `json:"red_flags"`
+	OverallScore   int               `json:"overall_score"`
+	Summary        string            `json:"summary"`
+	Tips           []string          `json:"tips"`
+}
+
+// RoomChatTrainReport is the saved coaching report, every train room only have one report
+type RoomChatTrainReport struct {
+	Id       int    `json:"id"`
+	RoomCode string `json:"room_code"`
+	RoomChatTrainReportRes
+	CreatedAt string `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+const (
+	// max length (in character) of persona field, persona placed on the train room system prompt so it kept short
+	PERSONA_NAME_MAX_LENGTH            = 50
+	PERSONA_EMPLOYMENT_TYPE_MAX_LENGTH = 100
+	PERSONA_DESCRIPTION_MAX_LENGTH     = 300
+	PERSONA_HOBBY_MAX_LENGTH           = 200
+	PERSONA_PERSONALITY_MAX_LENGTH     = 200
+
+	// persona list scope
+	PERSONA_SCOPE_ALL     = "all"
+	PERSONA_SCOPE_MINE    = "mine"
+	PERSONA_SCOPE_CURATED = "curated"
+	PERSONA_SCOPE_SHARED  = "shared"
+)
+
+// TrainPersona is saved persona for train room, curated persona created by assistant user (id 0) and visible for every user
+// user persona only visible for the creator until it is shared
+type TrainPersona struct {
+	Id              int    `json:"id"`
+	CreatedBy       int    `json:"created_by"`
+	CreatorUsername string `json:"creator_username"`
+	Name            string `json:"name"`
+	Gender          string `json:"gender"`
+	Language        string `json:"language"`
+	RangeAge        string `json:"range_age"`
+	EmploymentType  string `json:"employment_type"`
+	Description     string `json:"description"`
+	Hobby           string `json:"hobby"`
+	Personality     string `json:"personality"`
+	IsCurated       bool   `json:"is_curated"`
+	IsShared        bool   `json:"is_shared"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+type TrainPersonaCreate struct {
+	Name           string `json:"name" validate:"required,max=50,persona_text"`
+	Gender         string `json:"gender" validate:"required,oneof=male female"`
+	Language       string `json:"language" validate:"required,oneof=indonesia english"`
+	RangeAge       string `json:"range_age" validate:"required,oneof=18-24 25-30 31-40 41-50"`
+	EmploymentType string `json:"employment_type" validate:"required,max=100,persona_text"`
+	Description    string `json:"description" validate:"required,max=300,persona_text"`
+	Hobby          string `json:"hobby" validate:"required,max=200,persona_text"`
+	Personality    string `json:"personality" validate:"required,max=200,persona_text"`
+	IsShared       bool   `json:"is_shared"`
+}
+
+type TrainPersonaEdit struct {
+	Id int `json:"id" validate:"required"`
+	TrainPersonaCreate
+}
+
+type TrainPersonaDelete struct {
+	Id int `json:"id" validate:"required"`
+}
@@ -0,0 +1,88 @@
+package permission
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+)
+
+// central permission check for room action based on user role in the room
+// role rank: owner > moderator > member
+
+type Action string
+
+const (
+	ActionEditRoom         Action = "edit_room"
+	ActionDeleteRoom       Action = "delete_room"
+	ActionDeleteMessage    Action = "delete_message" // delete message from other user
+	ActionKickMember       Action = "kick_member"
+	ActionBanMember        Action = "ban_member"
+	ActionInviteMember     Action = "invite_member"
+	ActionManageRole       Action = "manage_role"
+	ActionReviewJoin       Action = "review_join_request"
+	ActionPinMessage       Action = "pin_message"
+	ActionPostAnnouncement Action = "post_announcement" // post message in announcement room
+)
+
+var (
+	roleRank = map[string]int{
+		models.ROOM_ROLE_MEMBER:    1,
+		models.ROOM_ROLE_MODERATOR: 2,
+		models.ROOM_ROLE_OWNER:     3,
+	}
+
+	// role allowed for every action
+	actionRoles = map[Action][]string{
+		ActionEditRoom:         {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionDeleteRoom:       {models.ROOM_ROLE_OWNER},
+		ActionDeleteMessage:    {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionKickMember:       {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionBanMember:        {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionInviteMember:     {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionManageRole:       {models.ROOM_ROLE_OWNER},
+		ActionReviewJoin:       {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionPinMessage:       {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+		ActionPostAnnouncement: {models.ROOM_ROLE_OWNER, models.ROOM_ROLE_MODERATOR},
+	}
+)
+
+// RoomRole get role of user in the room, owner is the room creator
+// direct conversation don't have owner, so the creator is member just like the other user
+// return empty string if user is not owner and not member of the room
+func RoomRole(tx *sql.Tx, roomMemberRepo *roommember.RoomMemberRepo, room *models.RoomChatDataShow, userId int) (string, error) {
+	if room.CreatedBy == userId {
+		if room.IsDirect {
+			return models.ROOM_ROLE_MEMBER, nil
+		}
+		return models.ROOM_ROLE_OWNER, nil
+	}
+
+	return roomMemberRepo.FindRole(tx, userId, room.Id)
+}
+
+// Can check if role is allowed to do the action
+func Can(role string, action Action) bool {
+	for _, allowed := range actionRoles[action] {
+		if allowed == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanManage check if actor role is higher than target role, used for action to other member (e.g. kick)
+func CanManage(actorRole, targetRole string) bool {
+	return roleRank[actorRole] > roleRank[targetRole]
+}
+
+// Check resolve user role in the room and check if the role is allowed to do the action
+func Check(tx *sql.Tx, roomMemberRepo *roommember.RoomMemberRepo, room *models.RoomChatDataShow, userId int, action Action) (bool, error) {
+	role, err := RoomRole(tx, roomMemberRepo, room, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return Can(role, action), nil
+}
@@ -0,0 +1,133 @@
+package attachment
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+const attachmentQuery = "SELECT id, room_id, COALESCE(message_id, 0), uploaded_by, file_name, mime_type, size, is_image, storage_key, thumbnail_key, created_at FROM attachments"
+
+type AttachmentRepo struct{}
+
+func NewAttachmentRepo() *AttachmentRepo {
+	return &AttachmentRepo{}
+}
+
+func (r *AttachmentRepo) FindById(tx *sql.Tx, id int) (*models.Attachment, error) {
+	var attachment models.Attachment
+
+	query := attachmentQuery + " WHERE id = $1"
+
+	if err := scanAttachment(tx.QueryRow(query, id), &attachment); err != nil && err != sql.ErrNoRows {
+		return &attachment, err
+	}
+
+	return &attachment, nil
+}
+
+func (r *AttachmentRepo) FindByMessage(tx *sql.Tx, messageId int) (*[]models.Attachment, error) {
+	return r.findList(tx, attachmentQuery+" WHERE message_id = $1 ORDER BY id ASC", messageId)
+}
+
+// FindByRoom get every attachment of the room (include not sent attachment), used for cleanup the stored file
+func (r *AttachmentRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.Attachment, error) {
+	return r.findList(tx, attachmentQuery+" WHERE room_id = $1 ORDER BY id ASC", roomId)
+}
+
+func (r *AttachmentRepo) findList(tx *sql.Tx, query string, args ...interface{}) (*[]models.Attachment, error) {
+	var attachments []models.Attachment
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return &attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attachment models.Attachment
+
+		if err := scanAttachment(rows, &attachment); err != nil {
+			return &attachments, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return &attachments, nil
+}
+
+func (r *AttachmentRepo) Create(tx *sql.Tx, attachment *models.Attachment) error {
+	query := `INSERT INTO attachments (room_id, uploaded_by, file_name, mime_type, size, is_image, storage_key, thumbnail_key, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW()) RETURNING id, created_at`
+
+	if err := tx.QueryRow(query, attachment.RoomId, attachment.UploadedBy, attachment.FileName, attachment.MimeType, attachment.Size, attachment.IsImage, attachment.StorageKey, attachment.ThumbnailKey).Scan(&attachment.Id, &attachment.CreatedAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LinkToMessage set the message of not sent attachment, only attachment uploaded by the sender on the same room can be linked
+// return total attachment linked
+func (r *AttachmentRepo) LinkToMessage(tx *sql.Tx, ids []int, message *models.Message) (int, error) {
+	query := "UPDATE attachments SET message_id = $1 WHERE id = ANY($2) AND room_id = $3 AND uploaded_by = $4 AND message_id IS NULL"
+
+	res, err := tx.Exec(query, message.Id, pq.Array(ids), message.RoomId, message.SenderId)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
+
+func (r *AttachmentRepo) DeleteByMessage(tx *sql.Tx, messageId int) error {
+	query := "DELETE FROM attachments WHERE message_id = $1"
+
+	if _, err := tx.Exec(query, messageId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUnsent delete attachment that uploaded longer than max age ago and not sent with any message, deleted attachment returned for cleanup the stored file
+func (r *AttachmentRepo) DeleteUnsent(tx *sql.Tx, maxAge time.Duration) (*[]models.Attachment, error) {
+	var attachments []models.Attachment
+
+	query := `DELETE FROM attachments WHERE message_id IS NULL AND created_at < NOW() - ($1 * INTERVAL '1 second') 
+		RETURNING id, room_id, COALESCE(message_id, 0), uploaded_by, file_name, mime_type, size, is_image, storage_key, thumbnail_key, created_at`
+
+	rows, err := tx.Query(query, int(maxAge.Seconds()))
+	if err != nil {
+		return &attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attachment models.Attachment
+
+		if err := scanAttachment(rows, &attachment); err != nil {
+			return &attachments, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return &attachments, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(row rowScanner, attachment *models.Attachment) error {
+	return row.Scan(&attachment.Id, &attachment.RoomId, &attachment.MessageId, &attachment.UploadedBy, &attachment.FileName, &attachment.MimeType, &attachment.Size, &attachment.IsImage, &attachment.StorageKey, &attachment.ThumbnailKey, &attachment.CreatedAt)
+}
@@ -0,0 +1,98 @@
+package direct
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type DirectRoomRepo struct{}
+
+func NewDirectRoomRepo() *DirectRoomRepo {
+	return &DirectRoomRepo{}
+}
+
+// userPair return the user id ordered, smaller user id always be the user one
+func userPair(userA, userB int) (int, int) {
+	if userA < userB {
+		return userA, userB
+	}
+	return userB, userA
+}
+
+// FindByUsers get direct conversation of the user pair, return room code empty if the conversation is not exist
+func (r *DirectRoomRepo) FindByUsers(tx *sql.Tx, userA, userB int) (*models.DirectRoomShow, error) {
+	var direct models.DirectRoomShow
+
+	userOne, userTwo := userPair(userA, userB)
+	query := "SELECT dr.room_id, rc.code, dr.created_at FROM direct_rooms dr LEFT JOIN room_chat rc ON dr.room_id = rc.id WHERE dr.user_one_id = $1 AND dr.user_two_id = $2"
+
+	if err := tx.QueryRow(query, userOne, userTwo).Scan(&direct.RoomId, &direct.RoomCode, &direct.CreatedAt); err != nil && err != sql.ErrNoRows {
+		return &direct, err
+	}
+
+	return &direct, nil
+}
+
+// FindByUser get direct conversation of the user with the last message and unread count, newest activity first
+func (r *DirectRoomRepo) FindByUser(tx *sql.Tx, user_id, page, per_page int) (*[]models.DirectRoomShow, int, error) {
+	var directs []models.DirectRoomShow
+	offset := (page - 1) * per_page
+	total := 0
+
+	total_query := "SELECT COUNT(id) FROM direct_rooms WHERE user_one_id = $1 OR user_two_id = $1"
+	if err := tx.QueryRow(total_query, user_id).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return &directs, total, err
+	}
+
+	query := `
+		SELECT dr.room_id, rc.code, ou.id, ou.username, dr.created_at, 
+			COALESCE(lm.id, 0), COALESCE(lm.sender_id, 0), COALESCE(lm.content, ''), COALESCE(lm.created_at::text, ''), COALESCE(lm.deleted_at IS NOT NULL, FALSE), 
+			(SELECT COUNT(m.id) FROM messages m WHERE m.room_id = dr.room_id AND m.sender_id <> $1 AND m.id > COALESCE((SELECT rr.last_read_message_id FROM room_reads rr WHERE rr.room_id = dr.room_id AND rr.user_id = $1), 0)) 
+		FROM direct_rooms dr 
+		LEFT JOIN room_chat rc ON dr.room_id = rc.id 
+		LEFT JOIN users ou ON ou.id = CASE WHEN dr.user_one_id = $1 THEN dr.user_two_id ELSE dr.user_one_id END 
+		LEFT JOIN LATERAL (SELECT id, sender_id, content, created_at, deleted_at FROM messages WHERE room_id = dr.room_id ORDER BY id DESC LIMIT 1) lm ON TRUE 
+		WHERE dr.user_one_id = $1 OR dr.user_two_id = $1 
+		ORDER BY COALESCE(lm.created_at, dr.created_at) DESC 
+		OFFSET $2 LIMIT $3`
+
+	rows, err := tx.Query(query, user_id, offset, per_page)
+	if err != nil {
+		return &directs, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var direct models.DirectRoomShow
+		var lastMessage models.DirectLastMessage
+
+		if err := rows.Scan(&direct.RoomId, &direct.RoomCode, &direct.UserId, &direct.Username, &direct.CreatedAt, &lastMessage.Id, &lastMessage.SenderId, &lastMessage.Content, &lastMessage.CreatedAt, &lastMessage.Deleted, &direct.UnreadCount); err != nil {
+			return &directs, total, err
+		}
+
+		if lastMessage.Id != 0 {
+			direct.LastMessage = &lastMessage
+		}
+
+		directs = append(directs, direct)
+	}
+
+	return &directs, total, nil
+}
+
+// Create direct conversation for the room, return false if the user pair already have conversation (e.g. created concurrently)
+func (r *DirectRoomRepo) Create(tx *sql.Tx, direct *models.DirectRoom) (bool, error) {
+	direct.UserOneId, direct.UserTwoId = userPair(direct.UserOneId, direct.UserTwoId)
+
+	query := "INSERT INTO direct_rooms (room_id, user_one_id, user_two_id, created_at) VALUES ($1, $2, $3, NOW()) ON CONFLICT (user_one_id, user_two_id) DO NOTHING RETURNING id, created_at"
+
+	if err := tx.QueryRow(query, direct.RoomId, direct.UserOneId, direct.UserTwoId).Scan(&direct.Id, &direct.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,101 @@
+package mention
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type MentionRepo struct{}
+
+func NewMentionRepo() *MentionRepo {
+	return &MentionRepo{}
+}
+
+// FindByUser get mention of the user across rooms ordered from the newest, only unread mention when unread_only is true
+// mention on deleted message is not showed
+func (r *MentionRepo) FindByUser(tx *sql.Tx, user_id, page, per_page int, unread_only bool) (*[]models.MentionShow, int, error) {
+	var mentions []models.MentionShow
+	offset := (page - 1) * per_page
+	total := 0
+
+	if user_id < 1 {
+		return &mentions, 0, errors.New("User ID is required")
+	}
+
+	baseQuery := ` FROM mentions mt 
+		LEFT JOIN messages m ON mt.message_id = m.id 
+		LEFT JOIN room_chat rc ON mt.room_id = rc.id 
+		LEFT JOIN users u ON mt.sender_id = u.id 
+		WHERE mt.user_id = $1 AND m.deleted_at IS NULL`
+	if unread_only {
+		baseQuery += " AND mt.read_at IS NULL"
+	}
+
+	total_query := "SELECT COUNT(mt.id)" + baseQuery
+	if err := tx.QueryRow(total_query, user_id).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return &mentions, total, err
+	}
+
+	query := "SELECT mt.id, mt.message_id, mt.room_id, mt.user_id, mt.sender_id, COALESCE(mt.read_at::text, ''), mt.created_at, rc.code, rc.name, u.username, m.content" +
+		baseQuery + " ORDER BY mt.id DESC OFFSET $2 LIMIT $3"
+
+	rows, err := tx.Query(query, user_id, offset, per_page)
+	if err != nil {
+		return &mentions, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mention models.MentionShow
+
+		if err := rows.Scan(&mention.Id, &mention.MessageId, &mention.RoomId, &mention.UserId, &mention.SenderId, &mention.ReadAt, &mention.CreatedAt, &mention.RoomCode, &mention.RoomName, &mention.SenderUsername, &mention.Content); err != nil {
+			return &mentions, total, err
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	return &mentions, total, nil
+}
+
+// Create save the mention, every user only mentioned once on the same message
+// return false if the mention already exist
+func (r *MentionRepo) Create(tx *sql.Tx, mention *models.Mention) (bool, error) {
+	query := "INSERT INTO mentions (message_id, room_id, user_id, sender_id, created_at) VALUES ($1, $2, $3, $4, NOW()) ON CONFLICT (message_id, user_id) DO NOTHING RETURNING id, created_at"
+
+	if err := tx.QueryRow(query, mention.MessageId, mention.RoomId, mention.UserId, mention.SenderId).Scan(&mention.Id, &mention.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MarkRead mark unread mention of the user as read, all unread mention marked when ids is empty
+// return total mention marked as read
+func (r *MentionRepo) MarkRead(tx *sql.Tx, user_id int, ids []int) (int, error) {
+	query := "UPDATE mentions SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL"
+	paramData := []interface{}{user_id}
+
+	if len(ids) > 0 {
+		query += " AND id = ANY($2)"
+		paramData = append(paramData, pq.Array(ids))
+	}
+
+	res, err := tx.Exec(query, paramData...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
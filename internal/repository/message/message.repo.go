@@ -2,36 +2,291 @@ package message
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/momokii/simple-chat-app/internal/models"
 )
 
+// message content escaped as html before highlighted by ts_headline, so the only markup on the snippet is the <mark> tag
+const searchSnippetQuery = `ts_headline('simple', replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), 
+	websearch_to_tsquery('simple', $1), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')`
+
+// column and join used for every MessageShow query, deleted message content is emptied as tombstone
+// parent preview and reply count (only not deleted reply) included for thread and attachment aggregated as json array
+const messageShowQuery = `SELECT m.id, m.room_id, m.sender_id, u.username, m.content, m.created_at, COALESCE(m.edited_at::text, ''), m.deleted_at IS NOT NULL, 
+	COALESCE(m.parent_id, 0), COALESCE(p.sender_id, 0), COALESCE(pu.username, ''), COALESCE(p.content, ''), p.deleted_at IS NOT NULL, 
+	(SELECT COUNT(r.id) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL), 
+	COALESCE((SELECT json_agg(json_build_object(
+		'id', a.id, 'file_name', a.file_name, 'mime_type', a.mime_type, 'size', a.size, 'is_image', a.is_image, 
+		'url', '` + models.ATTACHMENT_URL_PREFIX + `' || a.id, 
+		'thumbnail_url', CASE WHEN a.thumbnail_key <> '' THEN '` + models.ATTACHMENT_URL_PREFIX + `' || a.id || '` + models.ATTACHMENT_THUMBNAIL_SUFFIX + `' ELSE '' END
+	) ORDER BY a.id) FROM attachments a WHERE a.message_id = m.id AND m.deleted_at IS NULL), '[]') 
+	FROM messages m 
+	LEFT JOIN users u ON m.sender_id = u.id 
+	LEFT JOIN messages p ON m.parent_id = p.id 
+	LEFT JOIN users pu ON p.sender_id = pu.id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type MessageRepo struct{}
 
 func NewMessageRepo() *MessageRepo {
 	return &MessageRepo{}
 }
 
-func (r *MessageRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.MessageShow, error) {
+// FindByRoom get message in the room with cursor based pagination, the result always ordered from oldest to newest
+// - after > 0: message newer than after id (oldest first)
+// - before > 0: message older than before id (the nearest to before id)
+// - no cursor: the latest message
+// has more mean there is more message in the same direction of the cursor
+func (r *MessageRepo) FindByRoom(tx *sql.Tx, roomId, before, after, limit int) (*[]models.MessageShow, bool, error) {
 	var messages []models.MessageShow
 
 	if roomId < 1 {
-		return &messages, errors.New("Room ID is required")
+		return &messages, false, errors.New("Room ID is required")
 	}
 
-	query := "SELECT m.id, m.room_id, u.username, m.content, m.created_at FROM messages m LEFT JOIN users u ON m.sender_id = u.id WHERE room_id = $1 ORDER BY id ASC"
+	if limit < 1 {
+		return &messages, false, errors.New("Limit is required")
+	}
+
+	query := messageShowQuery + " WHERE m.room_id = $1"
+
+	idxParam := 2
+	paramData := []interface{}{roomId}
+	isAfter := after > 0
+	if isAfter {
+		query += " AND m.id > $" + fmt.Sprint(idxParam)
+		paramData = append(paramData, after)
+		idxParam++
+		query += " ORDER BY m.id ASC"
+	} else {
+		if before > 0 {
+			query += " AND m.id < $" + fmt.Sprint(idxParam)
+			paramData = append(paramData, before)
+			idxParam++
+		}
+		query += " ORDER BY m.id DESC"
+	}
 
-	rows, err := tx.Query(query, roomId)
+	// get one more data to check if there is more data
+	query += " LIMIT $" + fmt.Sprint(idxParam)
+	paramData = append(paramData, limit+1)
+
+	rows, err := tx.Query(query, paramData...)
 	if err != nil {
-		return &messages, err
+		return &messages, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.MessageShow
+
+		if err := scanMessageShow(rows, &message); err != nil {
+			return &messages, false, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	// query for before/latest is descending, reverse it so the result always oldest to newest
+	if !isAfter {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return &messages, hasMore, nil
+}
+
+// Search message with postgres full text search, only on room created or joined by the user
+// date_from and date_to using format YYYY-MM-DD and the snippet is highlighted with <mark> tag
+func (r *MessageRepo) Search(tx *sql.Tx, user_id, page, per_page int, search, room_code, sender, date_from, date_to string) (*[]models.MessageSearchShow, int, error) {
+	var messages []models.MessageSearchShow
+	offset := (page - 1) * per_page
+	total := 0
+
+	if user_id < 1 {
+		return &messages, 0, errors.New("User ID is required")
+	}
+
+	if search == "" {
+		return &messages, 0, errors.New("Search query is required")
+	}
+
+	baseQuery := ` FROM messages m 
+		LEFT JOIN users u ON m.sender_id = u.id 
+		LEFT JOIN room_chat rc ON m.room_id = rc.id 
+		WHERE m.deleted_at IS NULL 
+		AND to_tsvector('simple', m.content) @@ websearch_to_tsquery('simple', $1) 
+		AND (rc.created_by = $2 OR rc.id IN (SELECT room_id FROM room_members WHERE user_id = $2))`
+
+	idxParam := 3
+	paramData := []interface{}{search, user_id}
+
+	if room_code != "" {
+		baseQuery += " AND rc.code = $" + fmt.Sprint(idxParam)
+		paramData = append(paramData, room_code)
+		idxParam++
+	}
+
+	if sender != "" {
+		baseQuery += " AND u.username = $" + fmt.Sprint(idxParam)
+		paramData = append(paramData, sender)
+		idxParam++
+	}
+
+	if date_from != "" {
+		baseQuery += " AND m.created_at >= $" + fmt.Sprint(idxParam) + "::date"
+		paramData = append(paramData, date_from)
+		idxParam++
+	}
+
+	if date_to != "" {
+		// date_to is inclusive, so compare with the next day
+		baseQuery += " AND m.created_at < $" + fmt.Sprint(idxParam) + "::date + INTERVAL '1 day'"
+		paramData = append(paramData, date_to)
+		idxParam++
+	}
+
+	total_query := "SELECT COUNT(m.id)" + baseQuery
+	if err := tx.QueryRow(total_query, paramData...).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return &messages, total, err
+	}
+
+	query := `SELECT m.id, m.room_id, m.sender_id, u.username, m.content, m.created_at, COALESCE(m.edited_at::text, ''), m.deleted_at IS NOT NULL, COALESCE(m.parent_id, 0), rc.code, rc.name, 
+		` + searchSnippetQuery + baseQuery +
+		" ORDER BY ts_rank(to_tsvector('simple', m.content), websearch_to_tsquery('simple', $1)) DESC, m.id DESC OFFSET $" + fmt.Sprint(idxParam) + " LIMIT $" + fmt.Sprint(idxParam+1)
+	paramData = append(paramData, offset, per_page)
+
+	rows, err := tx.Query(query, paramData...)
+	if err != nil {
+		return &messages, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.MessageSearchShow
+
+		if err := rows.Scan(&message.Id, &message.RoomId, &message.SenderId, &message.SenderUsername, &message.Content, &message.CreatedAt, &message.EditedAt, &message.Deleted, &message.ParentId, &message.RoomCode, &message.RoomName, &message.Snippet); err != nil {
+			return &messages, total, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return &messages, total, nil
+}
+
+// FindThread get reply of the parent message with cursor based pagination (after is reply id), ordered from oldest to newest
+func (r *MessageRepo) FindThread(tx *sql.Tx, parentId, after, limit int) (*[]models.MessageShow, bool, error) {
+	var messages []models.MessageShow
+
+	if parentId < 1 {
+		return &messages, false, errors.New("Parent message ID is required")
+	}
+
+	if limit < 1 {
+		return &messages, false, errors.New("Limit is required")
+	}
+
+	// get one more data to check if there is more data
+	query := messageShowQuery + " WHERE m.parent_id = $1 AND m.id > $2 ORDER BY m.id ASC LIMIT $3"
+
+	rows, err := tx.Query(query, parentId, after, limit+1)
+	if err != nil {
+		return &messages, false, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var message models.MessageShow
 
-		if err := rows.Scan(&message.Id, &message.RoomId, &message.SenderUsername, &message.Content, &message.CreatedAt); err != nil {
+		if err := scanMessageShow(rows, &message); err != nil {
+			return &messages, false, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	return &messages, hasMore, nil
+}
+
+func (r *MessageRepo) FindShowById(tx *sql.Tx, id int) (*models.MessageShow, error) {
+	var message models.MessageShow
+
+	query := messageShowQuery + " WHERE m.id = $1"
+
+	if err := scanMessageShow(tx.QueryRow(query, id), &message); err != nil && err != sql.ErrNoRows {
+		return &message, err
+	}
+
+	return &message, nil
+}
+
+// FindParent get the thread parent preview for new reply, thread only one level deep
+// so when the replied message is a reply itself, the parent of that message (thread root) is returned
+func (r *MessageRepo) FindParent(tx *sql.Tx, id int) (*models.MessageParentShow, error) {
+	var parent models.MessageParentShow
+
+	query := `SELECT p.id, p.room_id, p.sender_id, COALESCE(u.username, ''), p.content, p.deleted_at IS NOT NULL 
+		FROM messages m 
+		LEFT JOIN messages p ON p.id = COALESCE(m.parent_id, m.id) 
+		LEFT JOIN users u ON p.sender_id = u.id 
+		WHERE m.id = $1`
+
+	if err := tx.QueryRow(query, id).Scan(&parent.Id, &parent.RoomId, &parent.SenderId, &parent.SenderUsername, &parent.Content, &parent.Deleted); err != nil && err != sql.ErrNoRows {
+		return &parent, err
+	}
+
+	return &parent, nil
+}
+
+// CountReplies count not deleted reply of the parent message
+func (r *MessageRepo) CountReplies(tx *sql.Tx, parentId int) (int, error) {
+	total := 0
+
+	query := "SELECT COUNT(id) FROM messages WHERE parent_id = $1 AND deleted_at IS NULL"
+
+	if err := tx.QueryRow(query, parentId).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// FindConversation get the latest not deleted message in the room ordered from oldest to newest, used as LLM conversation history
+func (r *MessageRepo) FindConversation(tx *sql.Tx, roomId, limit int) (*[]models.Message, error) {
+	var messages []models.Message
+
+	query := `SELECT id, room_id, sender_id, content, created_at FROM (
+		SELECT id, room_id, sender_id, content, created_at FROM messages WHERE room_id = $1 AND deleted_at IS NULL ORDER BY id DESC LIMIT $2
+	) latest ORDER BY id ASC`
+
+	rows, err := tx.Query(query, roomId, limit)
+	if err != nil {
+		return &messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.Message
+
+		if err := rows.Scan(&message.Id, &message.RoomId, &message.SenderId, &message.Content, &message.CreatedAt); err != nil {
 			return &messages, err
 		}
 
@@ -41,12 +296,73 @@ func (r *MessageRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.MessageShow,
 	return &messages, nil
 }
 
+func (r *MessageRepo) FindById(tx *sql.Tx, id int) (*models.Message, error) {
+	var message models.Message
+
+	query := "SELECT id, room_id, sender_id, content, created_at, COALESCE(edited_at::text, ''), deleted_at IS NOT NULL, COALESCE(parent_id, 0) FROM messages WHERE id = $1"
+
+	if err := tx.QueryRow(query, id).Scan(&message.Id, &message.RoomId, &message.SenderId, &message.Content, &message.CreatedAt, &message.EditedAt, &message.Deleted, &message.ParentId); err != nil && err != sql.ErrNoRows {
+		return &message, err
+	}
+
+	return &message, nil
+}
+
 func (r *MessageRepo) Create(tx *sql.Tx, message *models.Message) error {
-	query := "INSERT INTO messages (room_id, sender_id, content, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id"
+	query := "INSERT INTO messages (room_id, sender_id, content, parent_id, created_at) VALUES ($1, $2, $3, NULLIF($4, 0), NOW()) RETURNING id, created_at"
 
-	if _, err := tx.Exec(query, message.RoomId, message.SenderId, message.Content); err != nil {
+	// id and created_at returned so the caller can use the real stored data (e.g. for broadcast on websocket)
+	if err := tx.QueryRow(query, message.RoomId, message.SenderId, message.Content, message.ParentId).Scan(&message.Id, &message.CreatedAt); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Update change the message content, only work if the message is not deleted and still on the edit window (in seconds)
+// return false if the message can't be edited anymore
+func (r *MessageRepo) Update(tx *sql.Tx, message *models.Message, editWindow int) (bool, error) {
+	query := "UPDATE messages SET content = $1, edited_at = NOW() WHERE id = $2 AND deleted_at IS NULL AND created_at > NOW() - ($3 * INTERVAL '1 second') RETURNING COALESCE(edited_at::text, '')"
+
+	if err := tx.QueryRow(query, message.Content, message.Id, editWindow).Scan(&message.EditedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete is soft delete, the message row is kept as tombstone and the content is removed
+func (r *MessageRepo) Delete(tx *sql.Tx, id int) error {
+	query := "UPDATE messages SET content = '', deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL"
+
+	if _, err := tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanMessageShow(row rowScanner, message *models.MessageShow) error {
+	var parent models.MessageParentShow
+	var attachments []byte
+
+	if err := row.Scan(&message.Id, &message.RoomId, &message.SenderId, &message.SenderUsername, &message.Content, &message.CreatedAt, &message.EditedAt, &message.Deleted,
+		&message.ParentId, &parent.SenderId, &parent.SenderUsername, &parent.Content, &parent.Deleted, &message.ReplyCount, &attachments); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(attachments, &message.Attachments); err != nil {
+		return err
+	}
+
+	if message.ParentId != 0 {
+		parent.Id = message.ParentId
+		parent.RoomId = message.RoomId
+		message.Parent = &parent
+	}
+
+	return nil
+}
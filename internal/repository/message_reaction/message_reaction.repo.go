@@ -0,0 +1,96 @@
+package messagereaction
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type MessageReactionRepo struct{}
+
+func NewMessageReactionRepo() *MessageReactionRepo {
+	return &MessageReactionRepo{}
+}
+
+// FindSummaryByMessages get aggregated reaction for every message id, ordered by the first time the emoji used on the message
+// reacted by me is checked against user_id
+func (r *MessageReactionRepo) FindSummaryByMessages(tx *sql.Tx, messageIds []int, userId int) (map[int][]models.MessageReactionSummary, error) {
+	reactions := make(map[int][]models.MessageReactionSummary)
+
+	if len(messageIds) == 0 {
+		return reactions, nil
+	}
+
+	query := `SELECT message_id, emoji, COUNT(id), BOOL_OR(user_id = $2) 
+		FROM message_reactions 
+		WHERE message_id = ANY($1) 
+		GROUP BY message_id, emoji 
+		ORDER BY message_id, MIN(id)`
+
+	rows, err := tx.Query(query, pq.Array(messageIds), userId)
+	if err != nil {
+		return reactions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int
+		var reaction models.MessageReactionSummary
+
+		if err := rows.Scan(&messageId, &reaction.Emoji, &reaction.Count, &reaction.ReactedByMe); err != nil {
+			return reactions, err
+		}
+
+		reactions[messageId] = append(reactions[messageId], reaction)
+	}
+
+	return reactions, nil
+}
+
+func (r *MessageReactionRepo) CountByEmoji(tx *sql.Tx, messageId int, emoji string) (int, error) {
+	total := 0
+
+	query := "SELECT COUNT(id) FROM message_reactions WHERE message_id = $1 AND emoji = $2"
+
+	if err := tx.QueryRow(query, messageId, emoji).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// Create add the reaction, every (message, user, emoji) only counted once
+// return false if the user already reacted with the same emoji
+func (r *MessageReactionRepo) Create(tx *sql.Tx, reaction *models.MessageReaction) (bool, error) {
+	query := "INSERT INTO message_reactions (message_id, user_id, emoji, created_at) VALUES ($1, $2, $3, NOW()) ON CONFLICT (message_id, user_id, emoji) DO NOTHING"
+
+	res, err := tx.Exec(query, reaction.MessageId, reaction.UserId, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Delete remove the reaction, return false if the user not reacted with the emoji
+func (r *MessageReactionRepo) Delete(tx *sql.Tx, reaction *models.MessageReaction) (bool, error) {
+	query := "DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3"
+
+	res, err := tx.Exec(query, reaction.MessageId, reaction.UserId, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,87 @@
+package pinnedmessage
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type PinnedMessageRepo struct{}
+
+func NewPinnedMessageRepo() *PinnedMessageRepo {
+	return &PinnedMessageRepo{}
+}
+
+// FindByRoom get pinned message of the room ordered from the newest pin, pin of deleted message is not showed
+func (r *PinnedMessageRepo) FindByRoom(tx *sql.Tx, room_id int) (*[]models.PinnedMessageShow, error) {
+	var pins []models.PinnedMessageShow
+
+	query := `SELECT pm.id, pm.room_id, pm.message_id, pm.pinned_by, pm.created_at, pu.username, m.sender_id, u.username, m.content, m.created_at 
+		FROM pinned_messages pm 
+		LEFT JOIN messages m ON pm.message_id = m.id 
+		LEFT JOIN users u ON m.sender_id = u.id 
+		LEFT JOIN users pu ON pm.pinned_by = pu.id 
+		WHERE pm.room_id = $1 AND m.deleted_at IS NULL 
+		ORDER BY pm.id DESC`
+
+	rows, err := tx.Query(query, room_id)
+	if err != nil {
+		return &pins, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pin models.PinnedMessageShow
+
+		if err := rows.Scan(&pin.Id, &pin.RoomId, &pin.MessageId, &pin.PinnedBy, &pin.CreatedAt, &pin.PinnedByUsername, &pin.SenderId, &pin.SenderUsername, &pin.Content, &pin.MessageCreatedAt); err != nil {
+			return &pins, err
+		}
+
+		pins = append(pins, pin)
+	}
+
+	return &pins, nil
+}
+
+func (r *PinnedMessageRepo) CountByRoom(tx *sql.Tx, room_id int) (int, error) {
+	var total int
+
+	query := "SELECT COUNT(pm.id) FROM pinned_messages pm LEFT JOIN messages m ON pm.message_id = m.id WHERE pm.room_id = $1 AND m.deleted_at IS NULL"
+
+	if err := tx.QueryRow(query, room_id).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// Create pin the message, return false if the message already pinned
+func (r *PinnedMessageRepo) Create(tx *sql.Tx, pin *models.PinnedMessage) (bool, error) {
+	query := "INSERT INTO pinned_messages (room_id, message_id, pinned_by, created_at) VALUES ($1, $2, $3, NOW()) ON CONFLICT (message_id) DO NOTHING RETURNING id, created_at"
+
+	if err := tx.QueryRow(query, pin.RoomId, pin.MessageId, pin.PinnedBy).Scan(&pin.Id, &pin.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteByMessage unpin the message, return false if the message is not pinned
+func (r *PinnedMessageRepo) DeleteByMessage(tx *sql.Tx, message_id int) (bool, error) {
+	query := "DELETE FROM pinned_messages WHERE message_id = $1"
+
+	res, err := tx.Exec(query, message_id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
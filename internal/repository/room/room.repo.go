@@ -19,8 +19,10 @@ func (r *RoomChatRepo) Find(tx *sql.Tx, user_id, page, per_page int, is_user_roo
 	offset := (page - 1) * per_page
 	total := 0
 
-	total_query := "SELECT COUNT(rc.id) FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE 1 = 1"
-	query := "SELECT rc.id, rc.code, rc.created_by, u.username, rc.name, rc.description, rc.created_at, rc.is_private, rc.is_train_room FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE 1 = 1"
+	// direct conversation have their own listing, so never shown on room list
+	total_query := "SELECT COUNT(rc.id) FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE rc.is_direct = FALSE"
+	// select column added at the end, because unread count need extra parameter that not used by total query
+	query := " FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE rc.is_direct = FALSE"
 
 	idxParam := 1
 	paramData := []interface{}{}
@@ -84,6 +86,16 @@ func (r *RoomChatRepo) Find(tx *sql.Tx, user_id, page, per_page int, is_user_roo
 		return &rooms, total, err
 	}
 
+	// unread count only for room created or joined by the user (not for train room), based on last read message on room_reads
+	userParam := "$" + fmt.Sprint(idxParam)
+	unreadQuery := `CASE WHEN rc.is_train_room = FALSE AND (rc.created_by = ` + userParam + ` OR EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = rc.id AND rm.user_id = ` + userParam + `)) THEN 
+		(SELECT COUNT(m.id) FROM messages m WHERE m.room_id = rc.id AND m.sender_id <> ` + userParam + ` AND m.id > COALESCE((SELECT rr.last_read_message_id FROM room_reads rr WHERE rr.room_id = rc.id AND rr.user_id = ` + userParam + `), 0)) 
+		ELSE 0 END`
+	idxParam++
+	paramData = append(paramData, user_id)
+
+	query = "SELECT rc.id, rc.code, rc.created_by, u.username, rc.name, rc.description, rc.created_at, rc.is_private, rc.is_train_room, rc.join_policy, rc.is_announcement, " + unreadQuery + query
+
 	query += " ORDER BY rc.created_at " + filterType + " OFFSET $" + fmt.Sprint(idxParam) + " LIMIT $" + fmt.Sprint(idxParam+1)
 	idxParam += 2
 	paramData = append(paramData, offset, per_page)
@@ -98,7 +110,7 @@ func (r *RoomChatRepo) Find(tx *sql.Tx, user_id, page, per_page int, is_user_roo
 	for rows.Next() {
 		var room models.RoomChatDataShow
 
-		if err := rows.Scan(&room.Id, &room.RoomCode, &room.CreatedBy, &room.Username, &room.RoomName, &room.Description, &room.CreatedAt, &room.IsPrivate, &room.IsTrainRoom); err != nil {
+		if err := rows.Scan(&room.Id, &room.RoomCode, &room.CreatedBy, &room.Username, &room.RoomName, &room.Description, &room.CreatedAt, &room.IsPrivate, &room.IsTrainRoom, &room.JoinPolicy, &room.IsAnnouncement, &room.UnreadCount); err != nil {
 			return &rooms, total, err
 		}
 
@@ -115,7 +127,7 @@ func (r *RoomChatRepo) FindByCodeOrAndId(tx *sql.Tx, code string, id int) (*mode
 		return &room, fmt.Errorf("Code or/and ID is required")
 	}
 
-	query := "SELECT rc.id, rc.code, rc.created_by, u.username, rc.name, rc.description, rc.created_at, rc.is_private, rc.is_train_room, rc.password FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE 1=1"
+	query := "SELECT rc.id, rc.code, rc.created_by, u.username, rc.name, rc.description, rc.created_at, rc.is_private, rc.is_train_room, rc.password, rc.join_policy, rc.is_direct, rc.is_announcement FROM room_chat rc LEFT JOIN users u ON rc.created_by = u.id WHERE 1=1"
 
 	idx := 1
 	paramData := []interface{}{}
@@ -131,7 +143,7 @@ func (r *RoomChatRepo) FindByCodeOrAndId(tx *sql.Tx, code string, id int) (*mode
 		paramData = append(paramData, id)
 	}
 
-	if err := tx.QueryRow(query, paramData...).Scan(&room.Id, &room.RoomCode, &room.CreatedBy, &room.Username, &room.RoomName, &room.Description, &room.CreatedAt, &room.IsPrivate, &room.IsTrainRoom, &room.Password); err != nil && err != sql.ErrNoRows {
+	if err := tx.QueryRow(query, paramData...).Scan(&room.Id, &room.RoomCode, &room.CreatedBy, &room.Username, &room.RoomName, &room.Description, &room.CreatedAt, &room.IsPrivate, &room.IsTrainRoom, &room.Password, &room.JoinPolicy, &room.IsDirect, &room.IsAnnouncement); err != nil && err != sql.ErrNoRows {
 		return &room, err
 	}
 
@@ -139,9 +151,13 @@ func (r *RoomChatRepo) FindByCodeOrAndId(tx *sql.Tx, code string, id int) (*mode
 }
 
 func (r *RoomChatRepo) Create(tx *sql.Tx, room *models.RoomChat) error {
-	query := "INSERT INTO room_chat (code, created_by, name, description, password, is_private, is_train_room) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	query := "INSERT INTO room_chat (code, created_by, name, description, password, is_private, is_train_room, join_policy, is_direct, is_announcement) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+
+	if room.JoinPolicy == "" {
+		room.JoinPolicy = models.JOIN_POLICY_OPEN
+	}
 
-	if _, err := tx.Exec(query, room.RoomCode, room.CreatedBy, room.RoomName, room.Description, room.Password, room.IsPrivate, room.IsTrainRoom); err != nil {
+	if err := tx.QueryRow(query, room.RoomCode, room.CreatedBy, room.RoomName, room.Description, room.Password, room.IsPrivate, room.IsTrainRoom, room.JoinPolicy, room.IsDirect, room.IsAnnouncement).Scan(&room.Id); err != nil {
 		return err
 	}
 
@@ -150,7 +166,7 @@ func (r *RoomChatRepo) Create(tx *sql.Tx, room *models.RoomChat) error {
 
 func (r *RoomChatRepo) Update(tx *sql.Tx, room *models.RoomChat, is_update_password bool) error {
 
-	paramData := []interface{}{room.RoomName, room.Description, room.IsPrivate, room.Id}
+	paramData := []interface{}{room.RoomName, room.Description, room.IsPrivate, room.Id, room.JoinPolicy, room.IsAnnouncement}
 	paramCount := len(paramData)
 
 	query := "UPDATE room_chat SET name = $1, description = $2, updated_at = NOW(), password = "
@@ -164,7 +180,7 @@ func (r *RoomChatRepo) Update(tx *sql.Tx, room *models.RoomChat, is_update_passw
 		query += "password"
 	}
 
-	query += ", is_private = $3 WHERE id = $4"
+	query += ", is_private = $3, join_policy = $5, is_announcement = $6 WHERE id = $4"
 
 	if _, err := tx.Exec(query, paramData...); err != nil {
 		return err
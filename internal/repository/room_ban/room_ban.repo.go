@@ -0,0 +1,82 @@
+package roomban
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type RoomBanRepo struct{}
+
+func NewRoomBanRepo() *RoomBanRepo {
+	return &RoomBanRepo{}
+}
+
+// FindActiveBan check if user is banned from the room and the ban is not expired yet
+func (r *RoomBanRepo) FindActiveBan(tx *sql.Tx, userId, roomId int) (bool, error) {
+	query := "SELECT COUNT(id) FROM room_bans WHERE user_id = $1 AND room_id = $2 AND (expires_at IS NULL OR expires_at > NOW())"
+
+	var count int
+	if err := tx.QueryRow(query, userId, roomId).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// FindByRoom get list of active ban in the room
+func (r *RoomBanRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.RoomBanShow, error) {
+	var bans []models.RoomBanShow
+
+	query := `
+		SELECT rb.id, rb.room_id, rb.user_id, u.username, rb.banned_by, ub.username, rb.reason, COALESCE(rb.expires_at::text, ''), rb.created_at 
+		FROM room_bans rb 
+		LEFT JOIN users u ON rb.user_id = u.id 
+		LEFT JOIN users ub ON rb.banned_by = ub.id 
+		WHERE rb.room_id = $1 AND (rb.expires_at IS NULL OR rb.expires_at > NOW()) 
+		ORDER BY rb.created_at DESC`
+
+	rows, err := tx.Query(query, roomId)
+	if err != nil {
+		return &bans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ban models.RoomBanShow
+
+		if err := rows.Scan(&ban.Id, &ban.RoomId, &ban.UserId, &ban.Username, &ban.BannedBy, &ban.BannedByUsername, &ban.Reason, &ban.ExpiresAt, &ban.CreatedAt); err != nil {
+			return &bans, err
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return &bans, nil
+}
+
+// Upsert ban user from the room, duration in minutes and 0 mean permanent ban
+// banning user that already banned will replace the old ban
+func (r *RoomBanRepo) Upsert(tx *sql.Tx, ban *models.RoomBan, duration int) error {
+	query := `
+		INSERT INTO room_bans (room_id, user_id, banned_by, reason, expires_at, created_at) 
+		VALUES ($1, $2, $3, $4, CASE WHEN $5::int > 0 THEN NOW() + ($5::int * INTERVAL '1 minute') ELSE NULL END, NOW()) 
+		ON CONFLICT (room_id, user_id) DO UPDATE SET banned_by = EXCLUDED.banned_by, reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at, created_at = EXCLUDED.created_at 
+		RETURNING id, COALESCE(expires_at::text, ''), created_at`
+
+	if err := tx.QueryRow(query, ban.RoomId, ban.UserId, ban.BannedBy, ban.Reason, duration).Scan(&ban.Id, &ban.ExpiresAt, &ban.CreatedAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *RoomBanRepo) Delete(tx *sql.Tx, userId, roomId int) error {
+	query := "DELETE FROM room_bans WHERE user_id = $1 AND room_id = $2"
+
+	if _, err := tx.Exec(query, userId, roomId); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package roominvite
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type RoomInviteRepo struct{}
+
+func NewRoomInviteRepo() *RoomInviteRepo {
+	return &RoomInviteRepo{}
+}
+
+// invite is active when not revoked, not expired and still have remaining use
+const roomInviteActiveCondition = "ri.revoked_at IS NULL AND (ri.expires_at IS NULL OR ri.expires_at > NOW()) AND (ri.max_uses = 0 OR ri.used_count < ri.max_uses)"
+
+func (r *RoomInviteRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.RoomInviteShow, error) {
+	var invites []models.RoomInviteShow
+
+	query := `
+		SELECT ri.id, ri.room_id, ri.token, ri.created_by, u.username, ri.role, ri.max_uses, ri.used_count, COALESCE(ri.expires_at::text, ''), COALESCE(ri.revoked_at::text, ''), ri.created_at, ` + roomInviteActiveCondition + `
+		FROM room_invites ri 
+		LEFT JOIN users u ON ri.created_by = u.id 
+		WHERE ri.room_id = $1 
+		ORDER BY ri.created_at DESC`
+
+	rows, err := tx.Query(query, roomId)
+	if err != nil {
+		return &invites, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invite models.RoomInviteShow
+
+		if err := rows.Scan(&invite.Id, &invite.RoomId, &invite.Token, &invite.CreatedBy, &invite.CreatedByUsername, &invite.Role, &invite.MaxUses, &invite.UsedCount, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt, &invite.IsActive); err != nil {
+			return &invites, err
+		}
+
+		invites = append(invites, invite)
+	}
+
+	return &invites, nil
+}
+
+// FindActiveByToken get active invite by token, return invite with id 0 if the token is not exist or not active anymore
+func (r *RoomInviteRepo) FindActiveByToken(tx *sql.Tx, token string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+
+	query := `
+		SELECT ri.id, ri.room_id, ri.token, ri.created_by, ri.role, ri.max_uses, ri.used_count, COALESCE(ri.expires_at::text, ''), ri.created_at 
+		FROM room_invites ri 
+		WHERE ri.token = $1 AND ` + roomInviteActiveCondition
+
+	if err := tx.QueryRow(query, token).Scan(&invite.Id, &invite.RoomId, &invite.Token, &invite.CreatedBy, &invite.Role, &invite.MaxUses, &invite.UsedCount, &invite.ExpiresAt, &invite.CreatedAt); err != nil && err != sql.ErrNoRows {
+		return &invite, err
+	}
+
+	return &invite, nil
+}
+
+// Create new invite, duration in minutes and 0 mean never expired
+func (r *RoomInviteRepo) Create(tx *sql.Tx, invite *models.RoomInvite, duration int) error {
+	query := `
+		INSERT INTO room_invites (room_id, token, created_by, role, max_uses, expires_at, created_at) 
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6::int > 0 THEN NOW() + ($6::int * INTERVAL '1 minute') ELSE NULL END, NOW()) 
+		RETURNING id, COALESCE(expires_at::text, ''), created_at`
+
+	if err := tx.QueryRow(query, invite.RoomId, invite.Token, invite.CreatedBy, invite.Role, invite.MaxUses, duration).Scan(&invite.Id, &invite.ExpiresAt, &invite.CreatedAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Use increase used count of the invite only if the invite is still active, so concurrent redeem can't pass the max use
+// return false if the invite is not active anymore
+func (r *RoomInviteRepo) Use(tx *sql.Tx, id int) (bool, error) {
+	query := "UPDATE room_invites ri SET used_count = ri.used_count + 1 WHERE ri.id = $1 AND " + roomInviteActiveCondition
+
+	res, err := tx.Exec(query, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Revoke invite of the room, return false if the invite is not exist in the room or already revoked
+func (r *RoomInviteRepo) Revoke(tx *sql.Tx, id, roomId int) (bool, error) {
+	query := "UPDATE room_invites SET revoked_at = NOW() WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL"
+
+	res, err := tx.Exec(query, id, roomId)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,108 @@
+package roomjoinrequest
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type RoomJoinRequestRepo struct{}
+
+func NewRoomJoinRequestRepo() *RoomJoinRequestRepo {
+	return &RoomJoinRequestRepo{}
+}
+
+const roomJoinRequestShowQuery = `
+	SELECT rjr.id, rjr.room_id, rjr.user_id, u.username, rc.code, rc.name, rjr.message, rjr.status, rjr.reason, COALESCE(rjr.reviewed_by, 0), rjr.created_at, COALESCE(rjr.reviewed_at::text, '') 
+	FROM room_join_requests rjr 
+	LEFT JOIN users u ON rjr.user_id = u.id 
+	LEFT JOIN room_chat rc ON rjr.room_id = rc.id `
+
+func scanRoomJoinRequestShow(rows *sql.Rows, request *models.RoomJoinRequestShow) error {
+	return rows.Scan(&request.Id, &request.RoomId, &request.UserId, &request.Username, &request.RoomCode, &request.RoomName, &request.Message, &request.Status, &request.Reason, &request.ReviewedBy, &request.CreatedAt, &request.ReviewedAt)
+}
+
+func (r *RoomJoinRequestRepo) findShow(tx *sql.Tx, where string, args ...interface{}) (*[]models.RoomJoinRequestShow, error) {
+	var requests []models.RoomJoinRequestShow
+
+	rows, err := tx.Query(roomJoinRequestShowQuery+where, args...)
+	if err != nil {
+		return &requests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var request models.RoomJoinRequestShow
+
+		if err := scanRoomJoinRequestShow(rows, &request); err != nil {
+			return &requests, err
+		}
+
+		requests = append(requests, request)
+	}
+
+	return &requests, nil
+}
+
+// FindPendingByRoom get pending join request of the room, oldest first
+func (r *RoomJoinRequestRepo) FindPendingByRoom(tx *sql.Tx, roomId int) (*[]models.RoomJoinRequestShow, error) {
+	return r.findShow(tx, "WHERE rjr.room_id = $1 AND rjr.status = 'pending' ORDER BY rjr.created_at ASC", roomId)
+}
+
+// FindByUser get latest join request created by the user
+func (r *RoomJoinRequestRepo) FindByUser(tx *sql.Tx, userId, limit int) (*[]models.RoomJoinRequestShow, error) {
+	return r.findShow(tx, "WHERE rjr.user_id = $1 ORDER BY rjr.created_at DESC LIMIT $2", userId, limit)
+}
+
+func (r *RoomJoinRequestRepo) FindById(tx *sql.Tx, id int) (*models.RoomJoinRequestShow, error) {
+	var request models.RoomJoinRequestShow
+
+	requests, err := r.findShow(tx, "WHERE rjr.id = $1", id)
+	if err != nil {
+		return &request, err
+	}
+
+	if len(*requests) > 0 {
+		request = (*requests)[0]
+	}
+
+	return &request, nil
+}
+
+func (r *RoomJoinRequestRepo) FindPendingByUserAndRoom(tx *sql.Tx, userId, roomId int) (bool, error) {
+	query := "SELECT COUNT(id) FROM room_join_requests WHERE user_id = $1 AND room_id = $2 AND status = 'pending'"
+
+	var count int
+	if err := tx.QueryRow(query, userId, roomId).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *RoomJoinRequestRepo) Create(tx *sql.Tx, request *models.RoomJoinRequest) error {
+	query := "INSERT INTO room_join_requests (room_id, user_id, message, status, created_at) VALUES ($1, $2, $3, 'pending', NOW()) RETURNING id, status, created_at"
+
+	if err := tx.QueryRow(query, request.RoomId, request.UserId, request.Message).Scan(&request.Id, &request.Status, &request.CreatedAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Review approve or reject pending join request, return false if the request already reviewed
+func (r *RoomJoinRequestRepo) Review(tx *sql.Tx, request *models.RoomJoinRequest) (bool, error) {
+	query := "UPDATE room_join_requests SET status = $1, reason = $2, reviewed_by = $3, reviewed_at = NOW() WHERE id = $4 AND status = 'pending'"
+
+	res, err := tx.Exec(query, request.Status, request.Reason, request.ReviewedBy, request.Id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -26,7 +26,7 @@ func (r *RoomMemberRepo) FindUserInRoom(tx *sql.Tx, userId, roomId int) (bool, e
 func (r *RoomMemberRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.RoomMemberShow, error) {
 	var members []models.RoomMemberShow
 
-	query := "SELECT rm.id, rm.room_id, rm.user_id, u.username, rm.created_at FROM room_members rm LEFT JOIN users u ON rm.user_id = u.id WHERE room_id = $1 ORDER BY rm.created_at DESC"
+	query := "SELECT rm.id, rm.room_id, rm.user_id, u.username, rm.role, rm.created_at FROM room_members rm LEFT JOIN users u ON rm.user_id = u.id WHERE room_id = $1 ORDER BY rm.created_at DESC"
 
 	rows, err := tx.Query(query, roomId)
 	if err != nil {
@@ -37,7 +37,7 @@ func (r *RoomMemberRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.RoomMembe
 	for rows.Next() {
 		var member models.RoomMemberShow
 
-		if err := rows.Scan(&member.Id, &member.RoomId, &member.UserId, &member.Username, &member.CreatedAt); err != nil {
+		if err := rows.Scan(&member.Id, &member.RoomId, &member.UserId, &member.Username, &member.Role, &member.CreatedAt); err != nil {
 			return &members, err
 		}
 
@@ -47,10 +47,36 @@ func (r *RoomMemberRepo) FindByRoom(tx *sql.Tx, roomId int) (*[]models.RoomMembe
 	return &members, nil
 }
 
+// FindRole get role of user in the room, return empty string if user is not member of the room
+func (r *RoomMemberRepo) FindRole(tx *sql.Tx, userId, roomId int) (string, error) {
+	query := "SELECT role FROM room_members WHERE user_id = $1 AND room_id = $2"
+
+	var role string
+	if err := tx.QueryRow(query, userId, roomId).Scan(&role); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	return role, nil
+}
+
 func (r *RoomMemberRepo) Create(tx *sql.Tx, member *models.RoomMember) error {
-	query := "INSERT INTO room_members (room_id, user_id, created_at) VALUES ($1, $2, NOW())"
+	query := "INSERT INTO room_members (room_id, user_id, role, created_at) VALUES ($1, $2, $3, NOW())"
+
+	if member.Role == "" {
+		member.Role = models.ROOM_ROLE_MEMBER
+	}
+
+	if _, err := tx.Exec(query, member.RoomId, member.UserId, member.Role); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *RoomMemberRepo) UpdateRole(tx *sql.Tx, member *models.RoomMember) error {
+	query := "UPDATE room_members SET role = $1 WHERE user_id = $2 AND room_id = $3"
 
-	if _, err := tx.Exec(query, member.RoomId, member.UserId); err != nil {
+	if _, err := tx.Exec(query, member.Role, member.UserId, member.RoomId); err != nil {
 		return err
 	}
 
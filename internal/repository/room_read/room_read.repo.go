@@ -0,0 +1,49 @@
+package roomread
+
+import (
+	"database/sql"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type RoomReadRepo struct{}
+
+func NewRoomReadRepo() *RoomReadRepo {
+	return &RoomReadRepo{}
+}
+
+func (r *RoomReadRepo) FindByUserAndRoom(tx *sql.Tx, userId, roomId int) (*models.RoomRead, error) {
+	var roomRead models.RoomRead
+
+	query := "SELECT id, room_id, user_id, last_read_message_id, updated_at FROM room_reads WHERE user_id = $1 AND room_id = $2"
+
+	if err := tx.QueryRow(query, userId, roomId).Scan(&roomRead.Id, &roomRead.RoomId, &roomRead.UserId, &roomRead.LastReadMessageId, &roomRead.UpdatedAt); err != nil && err != sql.ErrNoRows {
+		return &roomRead, err
+	}
+
+	return &roomRead, nil
+}
+
+// Upsert save last read message of user in the room, the message must be exist in the room and last read message id never move backward
+// return false if message is not exist in the room
+func (r *RoomReadRepo) Upsert(tx *sql.Tx, roomRead *models.RoomRead) (bool, error) {
+	query := `
+		INSERT INTO room_reads (room_id, user_id, last_read_message_id, updated_at)
+		SELECT m.room_id, $2, m.id, NOW() FROM messages m WHERE m.id = $3 AND m.room_id = $1
+		ON CONFLICT (room_id, user_id) DO UPDATE SET 
+			last_read_message_id = GREATEST(room_reads.last_read_message_id, EXCLUDED.last_read_message_id),
+			updated_at = NOW()
+	`
+
+	res, err := tx.Exec(query, roomRead.RoomId, roomRead.UserId, roomRead.LastReadMessageId)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
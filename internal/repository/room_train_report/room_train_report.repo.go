@@ -0,0 +1,46 @@
+package roomtrainreport
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type RoomTrainReportRepo struct{}
+
+func NewRoomTrainReportRepo() *RoomTrainReportRepo {
+	return &RoomTrainReportRepo{}
+}
+
+// FindByRoomCode get the coaching report of train room, id is 0 if the report is not generated yet
+func (r *RoomTrainReportRepo) FindByRoomCode(tx *sql.Tx, room_code string) (*models.RoomChatTrainReport, error) {
+	var report models.RoomChatTrainReport
+
+	query := `SELECT id, room_code, engagement_score, engagement_feedback, humor_score, humor_feedback, question_asking_score, question_asking_feedback, red_flags, overall_score, summary, tips, created_at 
+		FROM room_chat_train_reports WHERE room_code = $1`
+
+	if err := tx.QueryRow(query, room_code).Scan(&report.Id, &report.RoomCode, &report.Engagement.Score, &report.Engagement.Feedback, &report.Humor.Score, &report.Humor.Feedback, &report.QuestionAsking.Score, &report.QuestionAsking.Feedback, pq.Array(&report.RedFlags), &report.OverallScore, &report.Summary, pq.Array(&report.Tips), &report.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return &report, nil
+		}
+		return &report, err
+	}
+
+	return &report, nil
+}
+
+// Create save the coaching report, return false if the room already have report
+func (r *RoomTrainReportRepo) Create(tx *sql.Tx, report *models.RoomChatTrainReport) (bool, error) {
+	query := `INSERT INTO room_chat_train_reports (room_code, engagement_score, engagement_feedback, humor_score, humor_feedback, question_asking_score, question_asking_feedback, red_flags, overall_score, summary, tips, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW()) ON CONFLICT (room_code) DO NOTHING RETURNING id, created_at`
+
+	if err := tx.QueryRow(query, report.RoomCode, report.Engagement.Score, report.Engagement.Feedback, report.Humor.Score, report.Humor.Feedback, report.QuestionAsking.Score, report.QuestionAsking.Feedback, pq.Array(report.RedFlags), report.OverallScore, report.Summary, pq.Array(report.Tips)).Scan(&report.Id, &report.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package trainpersona
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+type TrainPersonaRepo struct{}
+
+func NewTrainPersonaRepo() *TrainPersonaRepo {
+	return &TrainPersonaRepo{}
+}
+
+const personaColumn = "tp.id, tp.created_by, u.username, tp.name, tp.gender, tp.language, tp.range_age, tp.employment_type, tp.description, tp.hobby, tp.personality, tp.is_curated, tp.is_shared, tp.created_at, tp.updated_at"
+
+func scanPersona(row interface{ Scan(...any) error }, persona *models.TrainPersona) error {
+	return row.Scan(&persona.Id, &persona.CreatedBy, &persona.CreatorUsername, &persona.Name, &persona.Gender, &persona.Language, &persona.RangeAge, &persona.EmploymentType, &persona.Description, &persona.Hobby, &persona.Personality, &persona.IsCurated, &persona.IsShared, &persona.CreatedAt, &persona.UpdatedAt)
+}
+
+// FindVisible get persona that can be used by the user (curated, shared and created by the user) ordered from the newest
+// scope filter the list to curated, shared or the user persona only
+func (r *TrainPersonaRepo) FindVisible(tx *sql.Tx, user_id int, scope, search string, page, per_page int) (*[]models.TrainPersona, int, error) {
+	var personas []models.TrainPersona
+	offset := (page - 1) * per_page
+	total := 0
+
+	if user_id < 1 {
+		return &personas, 0, errors.New("User ID is required")
+	}
+
+	baseQuery := " FROM train_personas tp LEFT JOIN users u ON tp.created_by = u.id WHERE (tp.is_curated = TRUE OR tp.is_shared = TRUE OR tp.created_by = $1)"
+	paramData := []interface{}{user_id}
+
+	switch scope {
+	case models.PERSONA_SCOPE_MINE:
+		baseQuery += " AND tp.created_by = $1"
+	case models.PERSONA_SCOPE_CURATED:
+		baseQuery += " AND tp.is_curated = TRUE"
+	case models.PERSONA_SCOPE_SHARED:
+		baseQuery += " AND tp.is_shared = TRUE AND tp.is_curated = FALSE"
+	}
+
+	if search != "" {
+		paramData = append(paramData, "%"+search+"%")
+		baseQuery += fmt.Sprintf(" AND tp.name ILIKE $%d", len(paramData))
+	}
+
+	total_query := "SELECT COUNT(tp.id)" + baseQuery
+	if err := tx.QueryRow(total_query, paramData...).Scan(&total); err != nil && err != sql.ErrNoRows {
+		return &personas, total, err
+	}
+
+	query := "SELECT " + personaColumn + baseQuery + fmt.Sprintf(" ORDER BY tp.is_curated DESC, tp.id DESC OFFSET $%d LIMIT $%d", len(paramData)+1, len(paramData)+2)
+	paramData = append(paramData, offset, per_page)
+
+	rows, err := tx.Query(query, paramData...)
+	if err != nil {
+		return &personas, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var persona models.TrainPersona
+
+		if err := scanPersona(rows, &persona); err != nil {
+			return &personas, total, err
+		}
+
+		personas = append(personas, persona)
+	}
+
+	return &personas, total, nil
+}
+
+// FindById get persona by id, id is 0 if the persona not exist
+func (r *TrainPersonaRepo) FindById(tx *sql.Tx, id int) (*models.TrainPersona, error) {
+	var persona models.TrainPersona
+
+	query := "SELECT " + personaColumn + " FROM train_personas tp LEFT JOIN users u ON tp.created_by = u.id WHERE tp.id = $1"
+
+	if err := scanPersona(tx.QueryRow(query, id), &persona); err != nil {
+		if err == sql.ErrNoRows {
+			return &persona, nil
+		}
+		return &persona, err
+	}
+
+	return &persona, nil
+}
+
+func (r *TrainPersonaRepo) Create(tx *sql.Tx, persona *models.TrainPersona) error {
+	query := `INSERT INTO train_personas (created_by, name, gender, language, range_age, employment_type, description, hobby, personality, is_shared, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()) RETURNING id, created_at, updated_at`
+
+	if err := tx.QueryRow(query, persona.CreatedBy, persona.Name, persona.Gender, persona.Language, persona.RangeAge, persona.EmploymentType, persona.Description, persona.Hobby, persona.Personality, persona.IsShared).Scan(&persona.Id, &persona.CreatedAt, &persona.UpdatedAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Update edit the user persona, curated persona can't be edited, return false if the persona is not owned by the user
+func (r *TrainPersonaRepo) Update(tx *sql.Tx, persona *models.TrainPersona) (bool, error) {
+	query := `UPDATE train_personas SET name = $1, gender = $2, language = $3, range_age = $4, employment_type = $5, description = $6, hobby = $7, personality = $8, is_shared = $9, updated_at = NOW() 
+		WHERE id = $10 AND created_by = $11 AND is_curated = FALSE RETURNING created_at, updated_at`
+
+	if err := tx.QueryRow(query, persona.Name, persona.Gender, persona.Language, persona.RangeAge, persona.EmploymentType, persona.Description, persona.Hobby, persona.Personality, persona.IsShared, persona.Id, persona.CreatedBy).Scan(&persona.CreatedAt, &persona.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete remove the user persona, return false if the persona is not owned by the user
+func (r *TrainPersonaRepo) Delete(tx *sql.Tx, id, user_id int) (bool, error) {
+	query := "DELETE FROM train_personas WHERE id = $1 AND created_by = $2 AND is_curated = FALSE"
+
+	res, err := tx.Exec(query, id, user_id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
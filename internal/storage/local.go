@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage save the file on local filesystem under the base directory
+type LocalStorage struct {
+	baseDir string
+}
+
+func NewLocalStorage(baseDir string) (*LocalStorage, error) {
+	absDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(absDir, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{
+		baseDir: absDir,
+	}, nil
+}
+
+// path resolve the key to the file path, key escaping the base directory is rejected
+func (s *LocalStorage) path(key string) (string, error) {
+	if key == "" || filepath.IsAbs(key) {
+		return "", ErrInvalidKey
+	}
+
+	path := filepath.Join(s.baseDir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, s.baseDir+string(os.PathSeparator)) {
+		return "", ErrInvalidKey
+	}
+
+	return path, nil
+}
+
+func (s *LocalStorage) Save(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// write to temp file first so reader never get partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
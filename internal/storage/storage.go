@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+)
+
+var (
+	ErrNotFound   = errors.New("file is not exist on storage")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Storage is the file storage for attachment, key is relative path like "rooms/1/abc.png"
+// local filesystem implemented first, another backend (e.g. s3 compatible) only need to implement this interface
+type Storage interface {
+	// Save write the file to the key, existing file on the same key is replaced
+	Save(key string, r io.Reader) error
+	// Open return the file reader, ErrNotFound returned when the key is not exist
+	Open(key string) (io.ReadCloser, error)
+	// Delete remove the file, not exist key is not an error
+	Delete(key string) error
+}
+
+// DeleteAll delete every key on the storage, failed delete only logged so the other file still deleted
+func DeleteAll(s Storage, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		if err := s.Delete(key); err != nil {
+			log.Println("error delete file on storage: ", key, err)
+		}
+	}
+}
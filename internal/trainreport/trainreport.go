@@ -0,0 +1,200 @@
+package trainreport
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/llm"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/repository/message"
+	"github.com/momokii/simple-chat-app/internal/repository/room_train"
+	roomtrainreport "github.com/momokii/simple-chat-app/internal/repository/room_train_report"
+	"github.com/momokii/simple-chat-app/internal/ws"
+)
+
+// coaching report of ended train session, generated in background after the session ended
+// and can be generated again from the train report endpoint when the background generation failed
+
+const (
+	// max time for generating one report, not bound to the request so the report still saved when the client disconnected
+	generateTimeout = 3 * time.Minute
+)
+
+var (
+	ErrTrainNotFound   = errors.New("train room data not found")
+	ErrSessionNotEnded = errors.New("train session is not ended yet")
+	ErrNoMessage       = errors.New("train session don't have any message")
+)
+
+// Generator generate the report without holding any transaction while the LLM called
+// the same room only generated once at a time on this instance, other caller wait for the running generation
+type Generator struct {
+	roomTrainRepo room_train.RoomChatTrainRepo
+	messageRepo   message.MessageRepo
+	reportRepo    roomtrainreport.RoomTrainReportRepo
+	llmClient     llm.Client
+	wsManager     *ws.Manager
+
+	lock    sync.Mutex
+	running map[string]*generation
+}
+
+// generation is running report generation of the room, done closed after report and err set
+type generation struct {
+	done   chan struct{}
+	report *models.RoomChatTrainReport
+	err    error
+}
+
+func NewGenerator(roomTrainRepo room_train.RoomChatTrainRepo, messageRepo message.MessageRepo, reportRepo roomtrainreport.RoomTrainReportRepo, llmClient llm.Client, wsManager *ws.Manager) *Generator {
+	return &Generator{
+		roomTrainRepo: roomTrainRepo,
+		messageRepo:   messageRepo,
+		reportRepo:    reportRepo,
+		llmClient:     llmClient,
+		wsManager:     wsManager,
+		running:       make(map[string]*generation),
+	}
+}
+
+// GenerateInBackground generate the report after the session ended, result sent to the room as train_report event
+func (g *Generator) GenerateInBackground(room *models.RoomChatDataShow) {
+	go func() {
+		if _, err := g.Generate(context.Background(), room); err != nil {
+			log.Println("error generate train report: ", err)
+		}
+	}()
+}
+
+// Generate return the saved report of the room or generate it when not exist yet
+// ctx only used for waiting the result, the generation itself keep running when ctx done
+func (g *Generator) Generate(ctx context.Context, room *models.RoomChatDataShow) (*models.RoomChatTrainReport, error) {
+	g.lock.Lock()
+	current, ok := g.running[room.RoomCode]
+	if !ok {
+		current = &generation{done: make(chan struct{})}
+		g.running[room.RoomCode] = current
+
+		go func() {
+			current.report, current.err = g.generate(room)
+
+			g.lock.Lock()
+			delete(g.running, room.RoomCode)
+			g.lock.Unlock()
+			close(current.done)
+		}()
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-current.done:
+		return current.report, current.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *Generator) generate(room *models.RoomChatDataShow) (*models.RoomChatTrainReport, error) {
+	report, train, history, err := g.loadSession(room)
+	if err != nil || report.Id != 0 {
+		return report, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+
+	reportRes, err := g.llmClient.TrainReport(ctx, train, *history)
+	if err != nil {
+		g.broadcast(room.RoomCode, nil)
+		return nil, err
+	}
+
+	report, err = g.save(&models.RoomChatTrainReport{
+		RoomCode:               room.RoomCode,
+		RoomChatTrainReportRes: *reportRes,
+	})
+	if err != nil {
+		g.broadcast(room.RoomCode, nil)
+		return nil, err
+	}
+
+	g.broadcast(room.RoomCode, report)
+	return report, nil
+}
+
+// loadSession get the saved report, or the persona and the whole transcript when the report not generated yet
+func (g *Generator) loadSession(room *models.RoomChatDataShow) (report *models.RoomChatTrainReport, train *models.RoomChatTrain, history *[]models.Message, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err)
+	}()
+
+	report, err = g.reportRepo.FindByRoomCode(tx, room.RoomCode)
+	if err != nil || report.Id != 0 {
+		return report, nil, nil, err
+	}
+
+	train, err = g.roomTrainRepo.FindByRoomCode(tx, room.RoomCode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil, ErrTrainNotFound
+		}
+		return nil, nil, nil, err
+	}
+
+	// report evaluate the whole session, so it only can be created after the AI end the conversation
+	if train.IsStillContinue {
+		return nil, nil, nil, ErrSessionNotEnded
+	}
+
+	history, err = g.messageRepo.FindConversation(tx, room.Id, models.TRAIN_REPORT_MESSAGE_LIMIT)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(*history) == 0 {
+		return nil, nil, nil, ErrNoMessage
+	}
+
+	return report, train, history, nil
+}
+
+// save the generated report, report already saved by other instance returned instead
+func (g *Generator) save(report *models.RoomChatTrainReport) (savedReport *models.RoomChatTrainReport, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err)
+	}()
+
+	created, err := g.reportRepo.Create(tx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		return g.reportRepo.FindByRoomCode(tx, report.RoomCode)
+	}
+
+	return report, nil
+}
+
+// broadcast notify the train room the report is generated, nil report mean the generation failed
+func (g *Generator) broadcast(roomCode string, report *models.RoomChatTrainReport) {
+	if err := g.wsManager.BroadcastEvent(roomCode, ws.EventTrainReport, ws.TrainReportEvent{
+		RoomCode: roomCode,
+		Failed:   report == nil,
+	}); err != nil {
+		log.Println("error broadcast train report: ", err)
+	}
+}
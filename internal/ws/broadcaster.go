@@ -0,0 +1,211 @@
+package ws
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// broadcaster used by manager to fan-out event to every server instance
+// manager only publish event to broadcaster and every instance (include the publisher itself) will receive it from subscription and deliver it to the local client
+
+var (
+	ErrBroadcastPayloadTooLarge = errors.New("broadcast payload is too large")
+)
+
+// BroadcastMessage is the envelope for event sent through broadcaster
+// when UserId is set the event delivered to every connection of the user (in any room) instead of the room
+type BroadcastMessage struct {
+	Room   string `json:"room"`
+	UserId int    `json:"user_id,omitempty"`
+	Event  Event  `json:"event"`
+}
+
+type BroadcastHandler func(msg BroadcastMessage)
+
+type Broadcaster interface {
+	Publish(msg BroadcastMessage) error
+	Subscribe(handler BroadcastHandler)
+	Close() error
+	// MaxPayload is the max size (in bytes) of marshalled message can be published, 0 mean no limit
+	MaxPayload() int
+}
+
+// checkPayloadSize return ErrBroadcastPayloadTooLarge when the marshalled message can't be published by the broadcaster
+func checkPayloadSize(b Broadcaster, msg BroadcastMessage) error {
+	if b.MaxPayload() == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > b.MaxPayload() {
+		return ErrBroadcastPayloadTooLarge
+	}
+
+	return nil
+}
+
+// --- in memory broadcaster ---
+
+// LocalBroadcaster deliver event only to manager on same process, can be shared by multiple manager instance
+type LocalBroadcaster struct {
+	sync.RWMutex
+	handlers []BroadcastHandler
+}
+
+func NewLocalBroadcaster() *LocalBroadcaster {
+	return &LocalBroadcaster{}
+}
+
+func (b *LocalBroadcaster) Publish(msg BroadcastMessage) error {
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+
+	return nil
+}
+
+func (b *LocalBroadcaster) Subscribe(handler BroadcastHandler) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *LocalBroadcaster) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.handlers = nil
+	return nil
+}
+
+func (b *LocalBroadcaster) MaxPayload() int {
+	return 0
+}
+
+// --- postgres LISTEN/NOTIFY broadcaster ---
+
+const (
+	PostgresBroadcastChannel = "ws_broadcast"
+
+	// postgres notify payload limit is 8000 bytes
+	postgresNotifyMaxPayload = 8000
+)
+
+// PostgresBroadcaster publish event with NOTIFY using the shared db pool and receive event from dedicated LISTEN connection
+type PostgresBroadcaster struct {
+	db       *sql.DB
+	listener *pq.Listener
+	channel  string
+
+	local *LocalBroadcaster
+	done  chan struct{}
+}
+
+func NewPostgresBroadcaster(db *sql.DB, connStr string) (*PostgresBroadcaster, error) {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("error postgres broadcaster listener: ", err)
+		}
+	})
+
+	if err := listener.Listen(PostgresBroadcastChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &PostgresBroadcaster{
+		db:       db,
+		listener: listener,
+		channel:  PostgresBroadcastChannel,
+		local:    NewLocalBroadcaster(),
+		done:     make(chan struct{}),
+	}
+
+	go b.listen()
+
+	return b, nil
+}
+
+func (b *PostgresBroadcaster) Publish(msg BroadcastMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > postgresNotifyMaxPayload {
+		return ErrBroadcastPayloadTooLarge
+	}
+
+	if _, err := b.db.Exec("SELECT pg_notify($1, $2)", b.channel, string(data)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (b *PostgresBroadcaster) MaxPayload() int {
+	return postgresNotifyMaxPayload
+}
+
+func (b *PostgresBroadcaster) Subscribe(handler BroadcastHandler) {
+	b.local.Subscribe(handler)
+}
+
+func (b *PostgresBroadcaster) Close() error {
+	close(b.done)
+	b.local.Close()
+	return b.listener.Close()
+}
+
+func (b *PostgresBroadcaster) listen() {
+	// ping the listener connection periodically so broken connection can be detected and reconnected
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+
+		case notification, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+
+			// nil notification sent after reconnect, some event maybe missed while disconnected
+			if notification == nil {
+				log.Println("postgres broadcaster listener reconnected")
+				continue
+			}
+
+			var msg BroadcastMessage
+			if err := json.Unmarshal([]byte(notification.Extra), &msg); err != nil {
+				log.Println("error unmarshal broadcast message: ", err)
+				continue
+			}
+
+			b.local.Publish(msg)
+
+		case <-ticker.C:
+			go func() {
+				if err := b.listener.Ping(); err != nil {
+					log.Println("error ping postgres broadcaster listener: ", err)
+				}
+			}()
+		}
+	}
+}
@@ -3,19 +3,27 @@ package ws
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/momokii/simple-chat-app/internal/models"
 )
 
 // manage every client connection for websocket
 
 var (
+	writeWait = 10 * time.Second // how long we wait for write message to client before the connection considered broken
+
 	pongWait = 10 * time.Second // how long we wait for pong from client
 
 	pingInterval = (pongWait * 9) / 10 // how often we send ping to client to keep connection alive and the value is less than pongWait
 )
 
+// readLimit is max size of event from client, cover message content with max length where every character escaped as \uXXXX on json
+// plus the event envelope (type, parent id and attachment ids)
+const readLimit = models.MESSAGE_MAX_LENGTH*6 + 10*1024
+
 // list client connection with map
 type ClientList map[*Client]bool
 
@@ -23,19 +31,45 @@ type Client struct {
 	connection *websocket.Conn
 	manager    *Manager
 
+	// user is authenticated user data owned the connection, resolved from session when upgrade
+	user     models.UserSession
 	chatroom string
+	// roomId and isTrainRoom is data of the current chatroom, used when saving message
+	roomId      int
+	isTrainRoom bool
 
 	// egress used to send message to client
 	// egress will received as event from manager and write to connection
+	// egress is bounded buffered channel, so slow client will not block the broadcast
 	egress chan Event
+
+	// typing state of client, typingTimer used to expire typing state when client not send typing_start again
+	typingLock     sync.Mutex
+	typingTimer    *time.Timer
+	typingLastSent time.Time
+	typingRoom     string
+	typingGen      int
+
+	// replay state when client resume from last seen message, live event held on replayPending while replaying
+	replayLock    sync.Mutex
+	replaying     bool
+	replayPending []Event
+
+	// done closed when client removed, used to stop the write process
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func NewClient(conn *websocket.Conn, m *Manager, room_code *string) *Client {
+func NewClient(conn *websocket.Conn, m *Manager, user *models.UserSession, room *models.RoomChatDataShow) *Client {
 	return &Client{
-		connection: conn,
-		manager:    m,
-		egress:     make(chan Event),
-		chatroom:   *room_code,
+		connection:  conn,
+		manager:     m,
+		egress:      make(chan Event, m.egressBufferSize),
+		done:        make(chan struct{}),
+		user:        *user,
+		chatroom:    room.RoomCode,
+		roomId:      room.Id,
+		isTrainRoom: room.IsTrainRoom,
 	}
 }
 
@@ -62,8 +96,8 @@ func (c *Client) ReadMessage() {
 	}
 
 	// set read limit for connection to avoid large message
-	// if message size more than 512 bytes, the connection will be closed
-	c.connection.SetReadLimit(512)
+	// if message size more than read limit, the connection will be closed
+	c.connection.SetReadLimit(readLimit)
 
 	// set pong handler for connection
 	// pong handler will be called on ReadMessage below on for loop, there is just to set the handler
@@ -95,6 +129,8 @@ func (c *Client) ReadMessage() {
 		// router event to handler
 		if err := c.manager.RouterEvent(request, c); err != nil {
 			log.Println("error router event: ", err)
+			// let the client know the event is failed
+			c.SendError(request.Type, err)
 		}
 
 		// for wsClient := range c.manager.clients {
@@ -117,8 +153,14 @@ func (c *Client) WriteMessage() {
 	// ping used for keep connection alive and avoid connection closed by server
 	ticker := time.NewTicker(pingInterval)
 
+	defer ticker.Stop()
+
 	for {
 		select {
+		// client removed, stop the write process
+		case <-c.done:
+			return
+
 		// read message from channel
 		// message itself is Event struct
 		case message, ok := <-c.egress:
@@ -141,17 +183,28 @@ func (c *Client) WriteMessage() {
 			}
 
 			// send message to client
+			c.connection.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.connection.WriteMessage(websocket.TextMessage, data); err != nil {
 				log.Println("error write message: ", err)
 			}
 			// no return bcs we want to keep the loop until channel closed
 
+			// user removed from the room, close the connection after the event sent
+			if message.Type == EventRemovedFromRoom {
+				c.connection.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, message.Type)); err != nil {
+					log.Println("error write close message: ", err)
+				}
+				return
+			}
+
 		// ticker above will send ping/signal to ticker channel every pingInterval
 		// so case below will be executed/triggered every pingInterval
 		case <-ticker.C:
 			// send ping to client
 			// we can define the message type (for ping) and payload
 			// with we send the message PING to client and just to make the connection still alive and the ping message will be not doing anything
+			c.connection.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.connection.WriteMessage(websocket.PingMessage, []byte("")); err != nil {
 				log.Println("error write ping message: ", err)
 				return // return will break the loop if error happen
@@ -160,3 +213,86 @@ func (c *Client) WriteMessage() {
 
 	}
 }
+
+// SendError send error event only to this client
+func (c *Client) SendError(eventType string, err error) {
+	data, mErr := json.Marshal(ErrorEvent{
+		Event:   eventType,
+		Message: err.Error(),
+	})
+	if mErr != nil {
+		log.Println("error marshal error event: ", mErr)
+		return
+	}
+
+	c.Send(Event{
+		Type:    EventError,
+		Payload: data,
+	})
+}
+
+// Send queue the event to client without blocking, if the egress queue is full the manager slow client policy will be applied
+// while client is replaying missed message (resume), the event is held and sent after the replay done
+// return false if event is not queued
+func (c *Client) Send(event Event) bool {
+	c.replayLock.Lock()
+	if c.replaying {
+		if len(c.replayPending) < cap(c.egress) {
+			c.replayPending = append(c.replayPending, event)
+			c.replayLock.Unlock()
+			return true
+		}
+		c.replayLock.Unlock()
+		c.applySlowClientPolicy(event)
+		return false
+	}
+	c.replayLock.Unlock()
+
+	return c.enqueue(event)
+}
+
+func (c *Client) enqueue(event Event) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.egress <- event:
+		return true
+	default:
+	}
+
+	c.applySlowClientPolicy(event)
+	return false
+}
+
+// sendBlocking queue the event and wait until the egress has space, used when sending many event at once to single client (e.g. replay)
+func (c *Client) sendBlocking(event Event) bool {
+	select {
+	case c.egress <- event:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *Client) applySlowClientPolicy(event Event) {
+	switch c.manager.slowClientPolicy {
+	case SlowClientDrop:
+		log.Println("client egress queue is full, drop event: ", event.Type)
+	default:
+		log.Println("client egress queue is full, disconnect client")
+		// closing the connection will make read process stop and remove the client from manager
+		c.close()
+	}
+}
+
+// close the connection and stop the write process, safe to call multiple times
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.connection.Close()
+	})
+}
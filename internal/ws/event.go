@@ -3,6 +3,8 @@ package ws
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/momokii/simple-chat-app/internal/models"
 )
 
 // event struct for websocket message receive/send to client/fe
@@ -18,18 +20,217 @@ const (
 	EventSendMessage = "send_message"
 	EventNewMessage  = "new_message"
 	EventChatRoom    = "change_room"
+	EventError       = "error_message"
+
+	// presence event
+	EventUserJoined       = "user_joined"
+	EventUserLeft         = "user_left"
+	EventPresenceSnapshot = "presence_snapshot"
+
+	// typing indicator and read receipt event
+	EventTypingStart = "typing_start"
+	EventTypingStop  = "typing_stop"
+	EventMarkRead    = "mark_read"
+	EventReadReceipt = "read_receipt"
+
+	// resume event after reconnect
+	EventResume     = "resume"
+	EventResumeDone = "resume_done"
+
+	// message changed event
+	EventMessageEdited  = "message_edited"
+	EventMessageDeleted = "message_deleted"
+
+	// thread event, sent to the room when the thread parent got new reply
+	EventThreadReply = "thread_reply"
+
+	// reaction event, sent to the room when reaction added or removed from message
+	EventReactionUpdated = "reaction_updated"
+
+	// pin event, sent to the room when message pinned or unpinned
+	EventPinsUpdated = "pins_updated"
+
+	// AI reply event on train room, reply streamed as ai_delta and finished with ai_done
+	// ai_cancel sent by client to stop the running reply
+	EventAIDelta  = "ai_delta"
+	EventAIDone   = "ai_done"
+	EventAICancel = "ai_cancel"
+
+	// coaching report of ended train session generated (or failed to be generated) in background
+	EventTrainReport = "train_report"
+
+	// member removed from room event, only sent to the removed user and the connection closed after
+	EventRemovedFromRoom = "removed_from_room"
+)
+
+const (
+	// join request event, only sent to the related user
+	EventJoinRequestCreated  = "join_request_created"
+	EventJoinRequestReviewed = "join_request_reviewed"
+
+	// mention event, only sent to the mentioned user
+	EventMentioned = "mentioned"
+)
+
+const (
+	RemovedKicked = "kicked"
+	RemovedBanned = "banned"
 )
 
 type SendMessageEvent struct {
-	Message string `json:"message"`
-	From    string `json:"from"`
+	Message  string `json:"message"`
+	From     string `json:"from"`
+	ParentId int    `json:"parent_id"` // optional, reply to the message in the same room
+	// optional, id of uploaded attachment sent with the message
+	AttachmentIds []int `json:"attachment_ids"`
 }
 
 type NewMessageEvent struct {
 	SendMessageEvent
-	Sent time.Time `json:"sent"`
+	Id          int                       `json:"id"`
+	SenderId    int                       `json:"sender_id"`
+	CreatedAt   string                    `json:"created_at"`
+	EditedAt    string                    `json:"edited_at"`
+	Deleted     bool                      `json:"deleted"`
+	Parent      *models.MessageParentShow `json:"parent"`
+	ReplyCount  int                       `json:"reply_count"`
+	Attachments []models.AttachmentShow   `json:"attachments"`
+	Sent        time.Time                 `json:"sent"`
 }
 
 type ChangeRoomEvent struct {
 	Name string `json:"name"`
 }
+
+type ErrorEvent struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+type TypingEvent struct {
+	RoomCode string `json:"room_code"`
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type MarkReadEvent struct {
+	MessageId int `json:"message_id"`
+}
+
+type ReadReceiptEvent struct {
+	RoomCode  string `json:"room_code"`
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	MessageId int    `json:"message_id"`
+}
+
+type ResumeEvent struct {
+	LastMessageId int `json:"last_message_id"`
+}
+
+type ResumeDoneEvent struct {
+	RoomCode      string `json:"room_code"`
+	Replayed      int    `json:"replayed"`
+	LastMessageId int    `json:"last_message_id"`
+	HasMore       bool   `json:"has_more"`
+}
+
+type MessageEditedEvent struct {
+	Id       int    `json:"id"`
+	RoomCode string `json:"room_code"`
+	Content  string `json:"content"`
+	EditedAt string `json:"edited_at"`
+}
+
+type MessageDeletedEvent struct {
+	Id       int    `json:"id"`
+	RoomCode string `json:"room_code"`
+	ParentId int    `json:"parent_id"` // not 0 when the deleted message is a thread reply, so client can update the reply count
+}
+
+// ReactionUpdatedEvent count is the total reaction of the emoji on the message after updated
+// reacted by me state derived on client by comparing user_id
+type ReactionUpdatedEvent struct {
+	MessageId int    `json:"message_id"`
+	RoomCode  string `json:"room_code"`
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Emoji     string `json:"emoji"`
+	Action    string `json:"action"` // added or removed
+	Count     int    `json:"count"`
+}
+
+type AIDeltaEvent struct {
+	RoomCode string `json:"room_code"`
+	Delta    string `json:"delta"`
+}
+
+// AIDoneEvent message id is 0 when the reply cancelled or failed, because nothing saved
+type AIDoneEvent struct {
+	RoomCode      string `json:"room_code"`
+	Content       string `json:"content"`
+	ContinueChat  bool   `json:"continue_chat"`
+	Cancelled     bool   `json:"cancelled"`
+	Failed        bool   `json:"failed"`
+	UserMessageId int    `json:"user_message_id"`
+	MessageId     int    `json:"message_id"`
+}
+
+// TrainReportEvent only notify the report is ready (report can be bigger than broadcast payload limit), the report itself get from train report endpoint
+// failed report can be generated again from the same endpoint
+type TrainReportEvent struct {
+	RoomCode string `json:"room_code"`
+	Failed   bool   `json:"failed"`
+}
+
+// AICancelEvent broadcasted to every instance, so the instance running the reply can stop it
+type AICancelEvent struct {
+	RoomCode string `json:"room_code"`
+	UserId   int    `json:"user_id"`
+}
+
+// PinsUpdatedEvent pins is the full pinned message list of the room after updated
+type PinsUpdatedEvent struct {
+	RoomCode  string                     `json:"room_code"`
+	MessageId int                        `json:"message_id"`
+	Action    string                     `json:"action"` // pinned or unpinned
+	Pins      []models.PinnedMessageShow `json:"pins"`
+}
+
+type MentionedEvent struct {
+	Id        int    `json:"id"`
+	MessageId int    `json:"message_id"`
+	RoomCode  string `json:"room_code"`
+	RoomName  string `json:"room_name"`
+	SenderId  int    `json:"sender_id"`
+	From      string `json:"from"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ThreadReplyEvent struct {
+	ParentId   int    `json:"parent_id"`
+	RoomCode   string `json:"room_code"`
+	ReplyId    int    `json:"reply_id"`
+	From       string `json:"from"`
+	ReplyCount int    `json:"reply_count"`
+}
+
+type RemovedFromRoomEvent struct {
+	RoomCode  string `json:"room_code"`
+	UserId    int    `json:"user_id"`
+	Action    string `json:"action"` // kicked or banned
+	Reason    string `json:"reason"`
+	ExpiresAt string `json:"expires_at"` // only for ban, empty mean permanent ban
+}
+
+type JoinRequestEvent struct {
+	Id       int    `json:"id"`
+	RoomCode string `json:"room_code"`
+	RoomName string `json:"room_name"`
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Message  string `json:"message"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+}
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AI reply of train room is generated by http handler and streamed to the room as ai_delta event
+// only one reply generated on the same time for every room and the reply can be cancelled by the room owner with ai_cancel event
+
+var (
+	ErrGenerationRunning = errors.New("AI reply is still generating in this room")
+	ErrNoGeneration      = errors.New("no AI reply is generating in this room")
+)
+
+// AIDeltaFlushInterval is the minimum interval between ai_delta event, delta received before the interval is merged
+const AIDeltaFlushInterval = 50 * time.Millisecond
+
+type generation struct {
+	userId int
+	cancel context.CancelFunc
+}
+
+// StartGeneration register new AI reply on the room, the returned context cancelled when the user cancel the reply
+// finish must be called after the reply done so the room can generate the next reply
+func (m *Manager) StartGeneration(roomCode string, userId int) (context.Context, func(), error) {
+	m.generationLock.Lock()
+	defer m.generationLock.Unlock()
+
+	if _, ok := m.generations[roomCode]; ok {
+		return nil, nil, ErrGenerationRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	gen := &generation{
+		userId: userId,
+		cancel: cancel,
+	}
+	m.generations[roomCode] = gen
+
+	finish := func() {
+		m.generationLock.Lock()
+		if m.generations[roomCode] == gen {
+			delete(m.generations, roomCode)
+		}
+		m.generationLock.Unlock()
+		cancel()
+	}
+
+	return ctx, finish, nil
+}
+
+// applyCancel cancel the running reply on this instance, only the user started the reply can cancel it
+func (m *Manager) applyCancel(msg BroadcastMessage) {
+	var cancelEvent AICancelEvent
+	if err := json.Unmarshal(msg.Event.Payload, &cancelEvent); err != nil {
+		log.Println("error unmarshal ai cancel event: ", err)
+		return
+	}
+
+	m.generationLock.Lock()
+	defer m.generationLock.Unlock()
+
+	if gen, ok := m.generations[msg.Room]; ok && gen.userId == cancelEvent.UserId {
+		gen.cancel()
+	}
+}
+
+// AICancelHandler cancel the running AI reply on the current train room
+func AICancelHandler(event Event, c *Client) error {
+	if c.chatroom == "" {
+		return ErrNoRoom
+	}
+
+	if !c.isTrainRoom {
+		return errors.New("AI reply only available on train room")
+	}
+
+	return c.manager.BroadcastEvent(c.chatroom, EventAICancel, AICancelEvent{
+		RoomCode: c.chatroom,
+		UserId:   c.user.Id,
+	})
+}
+
+// AIStream send the reply delta to the room as ai_delta event
+type AIStream struct {
+	manager   *Manager
+	roomCode  string
+	lock      sync.Mutex
+	pending   strings.Builder
+	lastFlush time.Time
+}
+
+func (m *Manager) NewAIStream(roomCode string) *AIStream {
+	return &AIStream{
+		manager:  m,
+		roomCode: roomCode,
+	}
+}
+
+// Write add the delta and send it when the flush interval passed, failed broadcast only logged so the reply still generated
+func (s *AIStream) Write(delta string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pending.WriteString(delta)
+	if time.Since(s.lastFlush) >= AIDeltaFlushInterval {
+		s.flush()
+	}
+
+	return nil
+}
+
+// Flush send the remaining delta, must be called before ai_done sent
+func (s *AIStream) Flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flush()
+}
+
+func (s *AIStream) flush() {
+	if s.pending.Len() == 0 {
+		return
+	}
+
+	if err := s.manager.BroadcastEvent(s.roomCode, EventAIDelta, AIDeltaEvent{
+		RoomCode: s.roomCode,
+		Delta:    s.pending.String(),
+	}); err != nil {
+		log.Println("error broadcast ai delta: ", err)
+	}
+
+	s.pending.Reset()
+	s.lastFlush = time.Now()
+}
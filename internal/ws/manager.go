@@ -1,15 +1,31 @@
 package ws
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/websocket"
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/mention"
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/permission"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	mentionrepo "github.com/momokii/simple-chat-app/internal/repository/mention"
+	"github.com/momokii/simple-chat-app/internal/repository/message"
+	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roomban "github.com/momokii/simple-chat-app/internal/repository/room_ban"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	roomread "github.com/momokii/simple-chat-app/internal/repository/room_read"
+	"github.com/momokii/simple-chat-app/pkg/utils"
 )
 
 var (
@@ -19,20 +35,107 @@ var (
 	}
 )
 
+var (
+	ErrRoomNotFound       = errors.New("room is not exist")
+	ErrRoomNotAuthorized  = errors.New("you are not a member of this room")
+	ErrRoomBanned         = errors.New("you are banned from this room")
+	ErrNoRoom             = errors.New("you are not joined any room, please change room first")
+	ErrParentNotFound     = errors.New("replied message is not found in this room")
+	ErrAttachmentNotFound = errors.New("attachment is not found or already sent")
+	ErrAnnouncementOnly   = errors.New("only owner and moderator can post in announcement room")
+	ErrTrainRoomMessage   = errors.New("train room message must be sent through train message endpoint")
+	ErrMessageEmpty       = errors.New("message content or attachment is required")
+	ErrMessageTooLong     = fmt.Errorf("message content max %d characters", models.MESSAGE_MAX_LENGTH)
+	ErrTooManyAttachments = errors.New("max 10 attachment for every message")
+)
+
+// SlowClientPolicy define what manager do when client egress queue is full
+type SlowClientPolicy string
+
+const (
+	// SlowClientDisconnect close the client connection, client can reconnect and reload the data
+	SlowClientDisconnect SlowClientPolicy = "disconnect"
+	// SlowClientDrop drop the event for the client and keep the connection
+	SlowClientDrop SlowClientPolicy = "drop"
+
+	DefaultEgressBufferSize = 64
+)
+
+type ManagerConfig struct {
+	// Broadcaster used to fan-out event to every server instance, nil will use in memory broadcaster (single instance only)
+	Broadcaster Broadcaster
+	// EgressBufferSize is max queued event for every client before the slow client policy applied
+	EgressBufferSize int
+	SlowClientPolicy SlowClientPolicy
+}
+
 type Manager struct {
 	clients ClientList
+	// rooms index client by room code, so broadcast cost only grow with room size
+	rooms map[string]ClientList
+	// users index client by user id, used for event sent directly to user (e.g. notification)
+	users map[int]ClientList
 	sync.RWMutex
 
 	handlers map[string]EventHandler
+
+	// broadcaster used to fan-out event to every server instance
+	broadcaster      Broadcaster
+	egressBufferSize int
+	slowClientPolicy SlowClientPolicy
+
+	// localPresence count connection of user in room on this instance (room code -> user id -> connection count)
+	// presence count instance that report user online in room (room code -> user id -> entry)
+	presenceLock  sync.Mutex
+	localPresence map[string]map[int]int
+	presence      map[string]map[int]*presenceEntry
+
+	// generations is running AI reply on this instance (room code -> generation)
+	generationLock sync.Mutex
+	generations    map[string]*generation
+
+	roomChatRepo   room.RoomChatRepo
+	roomMemberRepo roommember.RoomMemberRepo
+	messageRepo    message.MessageRepo
+	roomReadRepo   roomread.RoomReadRepo
+	roomBanRepo    roomban.RoomBanRepo
+	mentionRepo    mentionrepo.MentionRepo
+	attachmentRepo attachment.AttachmentRepo
 }
 
-func NewManager() *Manager {
+func NewManager(config ManagerConfig, roomChatRepo room.RoomChatRepo, roomMemberRepo roommember.RoomMemberRepo, messageRepo message.MessageRepo, roomReadRepo roomread.RoomReadRepo, roomBanRepo roomban.RoomBanRepo, mentionRepo mentionrepo.MentionRepo, attachmentRepo attachment.AttachmentRepo) *Manager {
+	if config.Broadcaster == nil {
+		config.Broadcaster = NewLocalBroadcaster()
+	}
+	if config.EgressBufferSize < 1 {
+		config.EgressBufferSize = DefaultEgressBufferSize
+	}
+	if config.SlowClientPolicy != SlowClientDrop {
+		config.SlowClientPolicy = SlowClientDisconnect
+	}
+
 	m := &Manager{
-		clients:  make(ClientList),
-		handlers: make(map[string]EventHandler),
+		clients:          make(ClientList),
+		rooms:            make(map[string]ClientList),
+		users:            make(map[int]ClientList),
+		handlers:         make(map[string]EventHandler),
+		broadcaster:      config.Broadcaster,
+		egressBufferSize: config.EgressBufferSize,
+		slowClientPolicy: config.SlowClientPolicy,
+		localPresence:    make(map[string]map[int]int),
+		presence:         make(map[string]map[int]*presenceEntry),
+		generations:      make(map[string]*generation),
+		roomChatRepo:     roomChatRepo,
+		roomMemberRepo:   roomMemberRepo,
+		messageRepo:      messageRepo,
+		roomReadRepo:     roomReadRepo,
+		roomBanRepo:      roomBanRepo,
+		mentionRepo:      mentionRepo,
+		attachmentRepo:   attachmentRepo,
 	}
 
 	m.setupEventHandler()
+	m.broadcaster.Subscribe(m.deliverBroadcast)
 	return m
 }
 
@@ -42,6 +145,11 @@ func (m *Manager) setupEventHandler() {
 	// every event type will have its own handler
 	m.handlers[EventSendMessage] = SendMessage
 	m.handlers[EventChatRoom] = ChatRoomHandler
+	m.handlers[EventTypingStart] = TypingStartHandler
+	m.handlers[EventTypingStop] = TypingStopHandler
+	m.handlers[EventMarkRead] = MarkReadHandler
+	m.handlers[EventResume] = ResumeHandler
+	m.handlers[EventAICancel] = AICancelHandler
 }
 
 func (m *Manager) RouterEvent(event Event, c *Client) error {
@@ -58,10 +166,41 @@ func (m *Manager) RouterEvent(event Event, c *Client) error {
 	}
 }
 
+// ServeWS upgrade the request to websocket connection, the request must be passed through middlewares.IsWSAuth first so the user data is available on request context
 func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
 	log.Println("new connection")
 
-	room_code := r.URL.Query().Get("room_code")
+	user, ok := r.Context().Value("user").(models.UserSession)
+	if !ok || user.Id == 0 {
+		http.Error(w, "Unauthorized, please login first", http.StatusUnauthorized)
+		return
+	}
+
+	// room code come from path /ws/:room_code, query room_code still supported as fallback
+	room_code := path.Base(r.URL.Path)
+	if room_code == "" || room_code == "/" || room_code == "ws" {
+		room_code = r.URL.Query().Get("room_code")
+	}
+
+	// connection without room code only receive event sent directly to the user (e.g. notification on dashboard)
+	roomData := &models.RoomChatDataShow{}
+	if room_code != "" {
+		// check the user is allowed to join the room before upgrade the connection
+		var err error
+		roomData, err = m.AuthorizeRoom(&user, room_code)
+		if err != nil {
+			switch err {
+			case ErrRoomNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case ErrRoomNotAuthorized, ErrRoomBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				log.Println("error authorize room: ", err)
+				http.Error(w, "Failed to check room", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
 
 	conn, err := webSocketUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -70,9 +209,12 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// every new connection will create new client and manager will manage it
-	client := NewClient(conn, m, &room_code)
+	client := NewClient(conn, m, &user, roomData)
 
 	m.AddClient(client)
+	if client.chatroom != "" {
+		m.sendPresenceSnapshot(client, client.chatroom)
+	}
 
 	// start client processes
 	go client.ReadMessage()
@@ -80,56 +222,556 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Broadcast send event to all client in the room on every server instance
+func (m *Manager) Broadcast(roomCode string, event Event) error {
+	return m.broadcaster.Publish(BroadcastMessage{
+		Room:  roomCode,
+		Event: event,
+	})
+}
+
+// BroadcastEvent marshal the payload and broadcast it as event to the room, used by http handler to notify websocket client
+func (m *Manager) BroadcastEvent(roomCode, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshal payload: %v", err)
+	}
+
+	return m.Broadcast(roomCode, Event{Type: eventType, Payload: data})
+}
+
+// PrepareBroadcast marshal the payload as room event and check the event can be published by the broadcaster
+// called before the transaction committed, so event that can't be delivered returned as error to the caller instead of only logged after commit
+func (m *Manager) PrepareBroadcast(roomCode, eventType string, payload interface{}) (BroadcastMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return BroadcastMessage{}, fmt.Errorf("error marshal payload: %v", err)
+	}
+
+	msg := BroadcastMessage{
+		Room:  roomCode,
+		Event: Event{Type: eventType, Payload: data},
+	}
+
+	if err := checkPayloadSize(m.broadcaster, msg); err != nil {
+		return BroadcastMessage{}, err
+	}
+
+	return msg, nil
+}
+
+// Publish send the prepared broadcast message to every server instance
+func (m *Manager) Publish(msg BroadcastMessage) error {
+	return m.broadcaster.Publish(msg)
+}
+
+// SendToUser marshal the payload and send it as event to every connection of the user on every server instance
+func (m *Manager) SendToUser(userId int, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshal payload: %v", err)
+	}
+
+	return m.broadcaster.Publish(BroadcastMessage{
+		UserId: userId,
+		Event:  Event{Type: eventType, Payload: data},
+	})
+}
+
+// deliverBroadcast called by broadcaster subscription, send the event to local client in the room
+func (m *Manager) deliverBroadcast(msg BroadcastMessage) {
+	if msg.UserId != 0 {
+		m.RLock()
+		targets := make([]*Client, 0, len(m.users[msg.UserId]))
+		for client := range m.users[msg.UserId] {
+			targets = append(targets, client)
+		}
+		m.RUnlock()
+
+		for _, client := range targets {
+			client.Send(msg.Event)
+		}
+		return
+	}
+
+	// presence event only forwarded when user online status is changed
+	if msg.Event.Type == EventUserJoined || msg.Event.Type == EventUserLeft {
+		if !m.applyPresence(msg) {
+			return
+		}
+	}
+
+	// cancel event only used by the instance running the reply, not forwarded to client
+	if msg.Event.Type == EventAICancel {
+		m.applyCancel(msg)
+		return
+	}
+
+	// removed event only delivered to the removed user
+	removedUserId := 0
+	if msg.Event.Type == EventRemovedFromRoom {
+		var removed RemovedFromRoomEvent
+		if err := json.Unmarshal(msg.Event.Payload, &removed); err != nil {
+			log.Println("error unmarshal removed from room event: ", err)
+			return
+		}
+		removedUserId = removed.UserId
+	}
+
+	// collect target first so the lock is not held while sending to client
+	m.RLock()
+	targets := make([]*Client, 0, len(m.rooms[msg.Room]))
+	for client := range m.rooms[msg.Room] {
+		if removedUserId != 0 && client.user.Id != removedUserId {
+			continue
+		}
+		targets = append(targets, client)
+	}
+	m.RUnlock()
+
+	for _, client := range targets {
+		client.Send(msg.Event)
+	}
+}
+
+// RemoveUserFromRoom send removed_from_room event to every connection of the user in the room on every server instance
+// the connection closed after the event sent, used when user kicked or banned from the room
+func (m *Manager) RemoveUserFromRoom(removed RemovedFromRoomEvent) error {
+	return m.BroadcastEvent(removed.RoomCode, EventRemovedFromRoom, removed)
+}
+
 func (m *Manager) AddClient(client *Client) {
 	m.Lock()
-	defer m.Unlock()
-
 	m.clients[client] = true
+	m.addToUser(client)
+	m.addToRoom(client)
+	roomCode := client.chatroom
+	m.Unlock()
+
+	// presence broadcasted after the lock released because the broadcast will be delivered back to manager
+	m.userAttached(client, roomCode)
 }
 
 func (m *Manager) RemoveClient(client *Client) {
 	m.Lock()
-	defer m.Unlock()
-
-	if _, ok := m.clients[client]; ok {
-		client.connection.Close()
+	_, ok := m.clients[client]
+	if ok {
+		client.close()
 		delete(m.clients, client)
+		m.removeFromUser(client)
+		m.removeFromRoom(client)
+	}
+	roomCode := client.chatroom
+	m.Unlock()
+
+	if ok {
+		client.stopTyping(0)
+		m.userDetached(client, roomCode)
+	}
+}
+
+// MoveClient move client to another room and update the room index
+func (m *Manager) MoveClient(client *Client, roomData *models.RoomChatDataShow) {
+	// typing state belong to the old room
+	client.stopTyping(0)
+
+	m.Lock()
+	oldRoom := client.chatroom
+	m.removeFromRoom(client)
+	client.chatroom = roomData.RoomCode
+	client.roomId = roomData.Id
+	client.isTrainRoom = roomData.IsTrainRoom
+
+	// client maybe already removed while changing room
+	_, ok := m.clients[client]
+	if ok {
+		m.addToRoom(client)
+	}
+	m.Unlock()
+
+	if ok && oldRoom != roomData.RoomCode {
+		m.userDetached(client, oldRoom)
+		m.userAttached(client, roomData.RoomCode)
+		m.sendPresenceSnapshot(client, roomData.RoomCode)
+	}
+}
+
+// addToRoom and removeFromRoom must be called with manager lock held
+// client without room (user level connection) is not indexed on room
+func (m *Manager) addToRoom(client *Client) {
+	if client.chatroom == "" {
+		return
+	}
+
+	roomClients, ok := m.rooms[client.chatroom]
+	if !ok {
+		roomClients = make(ClientList)
+		m.rooms[client.chatroom] = roomClients
+	}
+
+	roomClients[client] = true
+}
+
+func (m *Manager) removeFromRoom(client *Client) {
+	roomClients, ok := m.rooms[client.chatroom]
+	if !ok {
+		return
+	}
+
+	delete(roomClients, client)
+	if len(roomClients) == 0 {
+		delete(m.rooms, client.chatroom)
+	}
+}
+
+// addToUser and removeFromUser must be called with manager lock held
+func (m *Manager) addToUser(client *Client) {
+	userClients, ok := m.users[client.user.Id]
+	if !ok {
+		userClients = make(ClientList)
+		m.users[client.user.Id] = userClients
+	}
+
+	userClients[client] = true
+}
+
+func (m *Manager) removeFromUser(client *Client) {
+	userClients, ok := m.users[client.user.Id]
+	if !ok {
+		return
+	}
+
+	delete(userClients, client)
+	if len(userClients) == 0 {
+		delete(m.users, client.user.Id)
+	}
+}
+
+// AuthorizeRoom check if user can join the room, user allowed if user is the creator of the room or already joined the room (room_members)
+// train room only can be accessed by the creator
+func (m *Manager) AuthorizeRoom(user *models.UserSession, roomCode string) (*models.RoomChatDataShow, error) {
+	if roomCode == "" {
+		return nil, ErrRoomNotFound
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		database.CommitOrRollback(tx, nil, err)
+	}()
+
+	roomData, err := m.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return nil, err
 	}
 
+	if roomData.Id == 0 {
+		return nil, ErrRoomNotFound
+	}
+
+	if roomData.CreatedBy == user.Id {
+		return roomData, nil
+	}
+
+	if roomData.IsTrainRoom {
+		return nil, ErrRoomNotAuthorized
+	}
+
+	isBanned, err := m.roomBanRepo.FindActiveBan(tx, user.Id, roomData.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBanned {
+		return nil, ErrRoomBanned
+	}
+
+	isMember, err := m.roomMemberRepo.FindUserInRoom(tx, user.Id, roomData.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMember {
+		return nil, ErrRoomNotAuthorized
+	}
+
+	return roomData, nil
 }
 
+// SendMessage validate the new message from client and post it to the current chatroom
+// so the websocket is the one source of truth for the message, message only broadcasted when successfully saved
 func SendMessage(event Event, c *Client) error {
 	var chatevent SendMessageEvent
-	var broadMessage NewMessageEvent
 
 	if err := json.Unmarshal(event.Payload, &chatevent); err != nil {
 		return fmt.Errorf("error unmarshal payload: %v", err)
 	}
 
-	broadMessage.Message = chatevent.Message
-	broadMessage.From = chatevent.From
-	broadMessage.Sent = time.Now()
+	if c.chatroom == "" {
+		return ErrNoRoom
+	}
 
-	data, err := json.Marshal(broadMessage)
-	if err != nil {
-		return fmt.Errorf("error marshal payload: %v", err)
+	newMessage := models.MessageCreate{
+		RoomCode:      c.chatroom,
+		SenderId:      c.user.Id,
+		Content:       strings.TrimSpace(chatevent.Message),
+		ParentId:      chatevent.ParentId,
+		AttachmentIds: chatevent.AttachmentIds,
+	}
+	if err := utils.ValidateStruct(newMessage); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "Content":
+				if err.Tag() == "max" {
+					return ErrMessageTooLong
+				}
+				return ErrMessageEmpty
+			case "AttachmentIds":
+				return ErrTooManyAttachments
+			default:
+				return errors.New("parent message ID and attachment ID must be positive number")
+			}
+		}
 	}
 
-	outgoingEvent := Event{
-		Payload: data,
-		Type:    EventNewMessage,
+	if newMessage.Content == "" && len(newMessage.AttachmentIds) == 0 {
+		return ErrMessageEmpty
 	}
 
-	for client := range c.manager.clients {
-		// only send message to client in same chatroom
-		if client.chatroom == c.chatroom {
-			client.egress <- outgoingEvent
+	if _, err := c.manager.PostMessage(&c.user, &newMessage); err != nil {
+		switch err {
+		case ErrRoomNotFound, ErrRoomNotAuthorized, ErrTrainRoomMessage, ErrParentNotFound, ErrAttachmentNotFound, ErrAnnouncementOnly, ErrBroadcastPayloadTooLarge:
+			return err
 		}
+		log.Println("error save message: ", err)
+		return errors.New("failed to save new message")
 	}
 
+	// message sent, so the sender is not typing anymore
+	c.stopTyping(0)
+
 	return nil
 }
 
+// PostMessage save the new message and broadcast it as new_message event (and thread_reply event for reply) after the message committed
+// shared by send_message event and message REST endpoint, so message from both path saved and delivered the same way
+func (m *Manager) PostMessage(sender *models.UserSession, newMessage *models.MessageCreate) (*NewMessageEvent, error) {
+	message := models.Message{
+		SenderId: sender.Id,
+		Content:  newMessage.Content,
+		ParentId: newMessage.ParentId,
+	}
+
+	saved, err := m.saveMessage(&message, newMessage.RoomCode, sender.Username, newMessage.AttachmentIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved.message, nil
+}
+
+// deliverMessage publish the prepared event and notify the mentioned member, only called after the message committed
+// message already saved, so failed broadcast only logged and not returned as error to avoid client resend the message
+func (m *Manager) deliverMessage(saved *savedMessage, senderUsername, content string) {
+	for _, event := range saved.events {
+		if err := m.Publish(event); err != nil {
+			log.Println("error broadcast message: ", err)
+		}
+	}
+
+	m.NotifyMentions(saved.mentions, saved.room, senderUsername, content)
+}
+
+// savedMessage is the related data after the message saved
+type savedMessage struct {
+	room *models.RoomChatDataShow
+	// message is the new_message event payload, events is the prepared broadcast published after the message committed
+	message  NewMessageEvent
+	events   []BroadcastMessage
+	mentions []models.Mention
+}
+
+// saveMessage save the message and when the message is a reply, the parent is resolved to the thread root on the same room
+// uploaded attachment linked to the message and mentioned room member on the message content saved as mention in the same transaction
+// sender role checked on every message because it can be changed while the user still connected
+// event and mention delivered after the commit, failed commit returned as error so nothing delivered for unsaved message
+func (m *Manager) saveMessage(message *models.Message, roomCode, senderUsername string, attachmentIds []int) (saved *savedMessage, err error) {
+	saved = &savedMessage{}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return saved, err
+	}
+	defer func() {
+		err = database.CommitOrRollback(tx, nil, err, func() {
+			m.deliverMessage(saved, senderUsername, message.Content)
+		})
+	}()
+
+	saved.room, err = m.roomChatRepo.FindByCodeOrAndId(tx, roomCode, 0)
+	if err != nil {
+		return saved, err
+	}
+
+	if saved.room.Id == 0 {
+		err = ErrRoomNotFound
+		return saved, err
+	}
+
+	// train room message saved through train endpoint because need to save the AI response too
+	if saved.room.IsTrainRoom {
+		err = ErrTrainRoomMessage
+		return saved, err
+	}
+	message.RoomId = saved.room.Id
+
+	var role string
+	role, err = permission.RoomRole(tx, &m.roomMemberRepo, saved.room, message.SenderId)
+	if err != nil {
+		return saved, err
+	}
+
+	if role == "" {
+		err = ErrRoomNotAuthorized
+		return saved, err
+	}
+
+	if saved.room.IsAnnouncement && !permission.Can(role, permission.ActionPostAnnouncement) {
+		err = ErrAnnouncementOnly
+		return saved, err
+	}
+
+	var parent *models.MessageParentShow
+	if message.ParentId != 0 {
+		parent, err = m.messageRepo.FindParent(tx, message.ParentId)
+		if err != nil {
+			return saved, err
+		}
+
+		if parent.Id == 0 || parent.RoomId != message.RoomId {
+			err = ErrParentNotFound
+			return saved, err
+		}
+		message.ParentId = parent.Id
+	}
+
+	if err = m.messageRepo.Create(tx, message); err != nil {
+		return saved, err
+	}
+
+	replyCount := 0
+	if parent != nil {
+		replyCount, err = m.messageRepo.CountReplies(tx, parent.Id)
+		if err != nil {
+			return saved, err
+		}
+	}
+
+	attachments := []models.AttachmentShow{}
+	if len(attachmentIds) > 0 {
+		var linked *[]models.Attachment
+		linked, err = LinkAttachments(tx, &m.attachmentRepo, message, attachmentIds)
+		if err != nil {
+			return saved, err
+		}
+
+		for _, attachment := range *linked {
+			attachments = append(attachments, attachment.Show())
+		}
+	}
+
+	saved.mentions, err = mention.Create(tx, &m.roomMemberRepo, &m.mentionRepo, saved.room, message)
+	if err != nil {
+		return saved, err
+	}
+
+	// sender identity always come from the authenticated user on server side, not from client payload
+	saved.message = NewMessageEvent{
+		SendMessageEvent: SendMessageEvent{
+			Message:  message.Content,
+			From:     senderUsername,
+			ParentId: message.ParentId,
+		},
+		Id:          message.Id,
+		SenderId:    message.SenderId,
+		CreatedAt:   message.CreatedAt,
+		Parent:      parent,
+		Attachments: attachments,
+		Sent:        time.Now(),
+	}
+	if sent, err := time.Parse(time.RFC3339Nano, message.CreatedAt); err == nil {
+		saved.message.Sent = sent
+	}
+
+	// event prepared before commit, so message that can't be delivered is not saved
+	var event BroadcastMessage
+	event, err = m.PrepareBroadcast(roomCode, EventNewMessage, saved.message)
+	if err != nil {
+		return saved, err
+	}
+	saved.events = append(saved.events, event)
+
+	if parent != nil {
+		event, err = m.PrepareBroadcast(roomCode, EventThreadReply, ThreadReplyEvent{
+			ParentId:   parent.Id,
+			RoomCode:   roomCode,
+			ReplyId:    message.Id,
+			From:       senderUsername,
+			ReplyCount: replyCount,
+		})
+		if err != nil {
+			return saved, err
+		}
+		saved.events = append(saved.events, event)
+	}
+
+	return saved, nil
+}
+
+// LinkAttachments link uploaded attachment to the saved message, every attachment must be uploaded by the sender on the same room and not sent yet
+// return ErrAttachmentNotFound if one of the attachment can't be linked
+func LinkAttachments(tx *sql.Tx, attachmentRepo *attachment.AttachmentRepo, message *models.Message, attachmentIds []int) (*[]models.Attachment, error) {
+	uniqueIds := make([]int, 0, len(attachmentIds))
+	seen := make(map[int]bool)
+	for _, id := range attachmentIds {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIds = append(uniqueIds, id)
+		}
+	}
+
+	linked, err := attachmentRepo.LinkToMessage(tx, uniqueIds, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if linked != len(uniqueIds) {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return attachmentRepo.FindByMessage(tx, message.Id)
+}
+
+// NotifyMentions send mentioned event to every mentioned user, wherever room the user connected to
+func (m *Manager) NotifyMentions(mentions []models.Mention, room *models.RoomChatDataShow, senderUsername, content string) {
+	for _, mentioned := range mentions {
+		if err := m.SendToUser(mentioned.UserId, EventMentioned, MentionedEvent{
+			Id:        mentioned.Id,
+			MessageId: mentioned.MessageId,
+			RoomCode:  room.RoomCode,
+			RoomName:  room.RoomName,
+			SenderId:  mentioned.SenderId,
+			From:      senderUsername,
+			Content:   content,
+			CreatedAt: mentioned.CreatedAt,
+		}); err != nil {
+			log.Println("error send mentioned event: ", err)
+		}
+	}
+}
+
 func ChatRoomHandler(event Event, c *Client) error {
 	var chatevent ChangeRoomEvent
 
@@ -137,7 +779,13 @@ func ChatRoomHandler(event Event, c *Client) error {
 		return fmt.Errorf("error unmarshal payload: %v", err)
 	}
 
-	c.chatroom = chatevent.Name
+	// user must be authorized to join the new room before moving the client
+	roomData, err := c.manager.AuthorizeRoom(&c.user, chatevent.Name)
+	if err != nil {
+		return fmt.Errorf("error change room: %v", err)
+	}
+
+	c.manager.MoveClient(c, roomData)
 
 	return nil
 }
@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/momokii/simple-chat-app/internal/models"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	"github.com/momokii/simple-chat-app/internal/repository/mention"
+	"github.com/momokii/simple-chat-app/internal/repository/message"
+	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roomban "github.com/momokii/simple-chat-app/internal/repository/room_ban"
+	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	roomread "github.com/momokii/simple-chat-app/internal/repository/room_read"
+)
+
+// newTestManager create manager without database, only used for delivering event
+func newTestManager(broadcaster Broadcaster) *Manager {
+	return NewManager(ManagerConfig{Broadcaster: broadcaster}, room.RoomChatRepo{}, roommember.RoomMemberRepo{}, message.MessageRepo{}, roomread.RoomReadRepo{}, roomban.RoomBanRepo{}, mention.MentionRepo{}, attachment.AttachmentRepo{})
+}
+
+// newTestClient create client without connection and register it on the manager
+func newTestClient(m *Manager, userId int, roomCode string) *Client {
+	client := NewClient(nil, m, &models.UserSession{Id: userId, Username: "user"}, &models.RoomChatDataShow{RoomCode: roomCode})
+	m.AddClient(client)
+	return client
+}
+
+// waitEvent return the first queued event with the event type, other event (e.g. presence) skipped
+func waitEvent(c *Client, eventType string) (Event, bool) {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-c.egress:
+			if event.Type == eventType {
+				return event, true
+			}
+		case <-timeout:
+			return Event{}, false
+		}
+	}
+}
+
+func TestBroadcastAcrossManager(t *testing.T) {
+	broadcaster := NewLocalBroadcaster()
+	managerA := newTestManager(broadcaster)
+	managerB := newTestManager(broadcaster)
+
+	clientB := newTestClient(managerB, 2, "room-1")
+	otherRoomClient := newTestClient(managerB, 3, "room-2")
+
+	edited := MessageEditedEvent{Id: 10, RoomCode: "room-1", Content: "edited"}
+	if err := managerA.BroadcastEvent("room-1", EventMessageEdited, edited); err != nil {
+		t.Fatalf("broadcast event: %v", err)
+	}
+
+	event, ok := waitEvent(clientB, EventMessageEdited)
+	if !ok {
+		t.Fatal("client on other manager not receive the room event")
+	}
+
+	var received MessageEditedEvent
+	if err := json.Unmarshal(event.Payload, &received); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if received != edited {
+		t.Fatalf("received payload %+v, want %+v", received, edited)
+	}
+
+	if _, ok := waitEvent(otherRoomClient, EventMessageEdited); ok {
+		t.Fatal("client on another room receive the room event")
+	}
+}
+
+func TestSendToUserAcrossManager(t *testing.T) {
+	broadcaster := NewLocalBroadcaster()
+	managerA := newTestManager(broadcaster)
+	managerB := newTestManager(broadcaster)
+
+	// connection without room (e.g. dashboard) still receive event sent to the user
+	clientB := newTestClient(managerB, 2, "")
+
+	if err := managerA.SendToUser(2, EventJoinRequestReviewed, JoinRequestEvent{Id: 1, UserId: 2}); err != nil {
+		t.Fatalf("send to user: %v", err)
+	}
+
+	if _, ok := waitEvent(clientB, EventJoinRequestReviewed); !ok {
+		t.Fatal("user connection on other manager not receive the event")
+	}
+}
@@ -0,0 +1,176 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+)
+
+// presence tracking for user online in the room
+// every instance broadcast user_joined when the first local connection of the user attached to the room and user_left when the last one detached
+// every manager then count how many instances report the user online from the broadcast, so multiple tabs (or instances) of same user count as one presence
+// notes: instance started later will only know presence from event after it started
+
+type PresenceUser struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type PresenceEvent struct {
+	RoomCode string `json:"room_code"`
+	PresenceUser
+}
+
+type PresenceSnapshotEvent struct {
+	RoomCode string         `json:"room_code"`
+	Users    []PresenceUser `json:"users"`
+}
+
+type presenceEntry struct {
+	user  PresenceUser
+	count int
+}
+
+// OnlineUsers return list of user online in the room
+func (m *Manager) OnlineUsers(roomCode string) []PresenceUser {
+	m.presenceLock.Lock()
+	defer m.presenceLock.Unlock()
+
+	users := make([]PresenceUser, 0, len(m.presence[roomCode]))
+	for _, entry := range m.presence[roomCode] {
+		users = append(users, entry.user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users
+}
+
+// userAttached called when client attached to the room, must be called without manager lock held
+func (m *Manager) userAttached(client *Client, roomCode string) {
+	if roomCode == "" {
+		return
+	}
+
+	m.presenceLock.Lock()
+	roomUsers, ok := m.localPresence[roomCode]
+	if !ok {
+		roomUsers = make(map[int]int)
+		m.localPresence[roomCode] = roomUsers
+	}
+	roomUsers[client.user.Id]++
+	isFirst := roomUsers[client.user.Id] == 1
+	m.presenceLock.Unlock()
+
+	if isFirst {
+		m.broadcastPresence(EventUserJoined, client, roomCode)
+	}
+}
+
+// userDetached called when client leave the room, must be called without manager lock held
+func (m *Manager) userDetached(client *Client, roomCode string) {
+	if roomCode == "" {
+		return
+	}
+
+	m.presenceLock.Lock()
+	isLast := false
+	if roomUsers, ok := m.localPresence[roomCode]; ok && roomUsers[client.user.Id] > 0 {
+		roomUsers[client.user.Id]--
+		if roomUsers[client.user.Id] == 0 {
+			isLast = true
+			delete(roomUsers, client.user.Id)
+		}
+		if len(roomUsers) == 0 {
+			delete(m.localPresence, roomCode)
+		}
+	}
+	m.presenceLock.Unlock()
+
+	if isLast {
+		m.broadcastPresence(EventUserLeft, client, roomCode)
+	}
+}
+
+func (m *Manager) broadcastPresence(eventType string, client *Client, roomCode string) {
+	data, err := json.Marshal(PresenceEvent{
+		RoomCode: roomCode,
+		PresenceUser: PresenceUser{
+			UserId:   client.user.Id,
+			Username: client.user.Username,
+		},
+	})
+	if err != nil {
+		log.Println("error marshal presence event: ", err)
+		return
+	}
+
+	if err := m.Broadcast(roomCode, Event{Type: eventType, Payload: data}); err != nil {
+		log.Println("error broadcast presence event: ", err)
+	}
+}
+
+// applyPresence update the presence state from broadcast event
+// return true if the event need to be forwarded to client (user become online or offline)
+func (m *Manager) applyPresence(msg BroadcastMessage) bool {
+	var presenceEvent PresenceEvent
+	if err := json.Unmarshal(msg.Event.Payload, &presenceEvent); err != nil {
+		log.Println("error unmarshal presence event: ", err)
+		return false
+	}
+
+	m.presenceLock.Lock()
+	defer m.presenceLock.Unlock()
+
+	roomUsers, ok := m.presence[msg.Room]
+	if !ok {
+		roomUsers = make(map[int]*presenceEntry)
+		m.presence[msg.Room] = roomUsers
+	}
+
+	entry, ok := roomUsers[presenceEvent.UserId]
+	switch msg.Event.Type {
+	case EventUserJoined:
+		if !ok {
+			entry = &presenceEntry{user: presenceEvent.PresenceUser}
+			roomUsers[presenceEvent.UserId] = entry
+		}
+		entry.count++
+		return entry.count == 1
+
+	case EventUserLeft:
+		if !ok {
+			return false
+		}
+		entry.count--
+		if entry.count > 0 {
+			return false
+		}
+		delete(roomUsers, presenceEvent.UserId)
+		if len(roomUsers) == 0 {
+			delete(m.presence, msg.Room)
+		}
+		return true
+	}
+
+	return false
+}
+
+// sendPresenceSnapshot send list of online user in the room to the client
+func (m *Manager) sendPresenceSnapshot(client *Client, roomCode string) {
+	data, err := json.Marshal(PresenceSnapshotEvent{
+		RoomCode: roomCode,
+		Users:    m.OnlineUsers(roomCode),
+	})
+	if err != nil {
+		log.Println("error marshal presence snapshot: ", err)
+		return
+	}
+
+	client.Send(Event{
+		Type:    EventPresenceSnapshot,
+		Payload: data,
+	})
+}
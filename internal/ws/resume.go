@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+// resume used by client after reconnect, server replay only the missed message from last seen message id before switching to live delivery
+// live event received while replaying is held on client and sent after replay done, so no message is missed between replay and live delivery
+
+var (
+	resumeReplayLimit = 200 // max message replayed, if there is more message client should reload the message list
+)
+
+func ResumeHandler(event Event, c *Client) error {
+	var resume ResumeEvent
+
+	if err := json.Unmarshal(event.Payload, &resume); err != nil {
+		return fmt.Errorf("error unmarshal payload: %v", err)
+	}
+
+	if c.chatroom == "" {
+		return ErrNoRoom
+	}
+
+	if resume.LastMessageId < 0 {
+		return errors.New("last message id is invalid")
+	}
+
+	c.beginReplay()
+
+	messages, hasMore, err := c.manager.findMessagesAfter(c.roomId, resume.LastMessageId, resumeReplayLimit)
+	if err != nil {
+		c.endReplay(resume.LastMessageId)
+		log.Println("error find missed message: ", err)
+		return errors.New("failed to get missed message")
+	}
+
+	lastId := resume.LastMessageId
+	for _, message := range *messages {
+		data, err := json.Marshal(newMessageEventFromShow(&message))
+		if err != nil {
+			c.endReplay(lastId)
+			return fmt.Errorf("error marshal payload: %v", err)
+		}
+
+		if !c.sendBlocking(Event{Type: EventNewMessage, Payload: data}) {
+			// client already closed
+			c.endReplay(lastId)
+			return nil
+		}
+		lastId = message.Id
+	}
+
+	data, err := json.Marshal(ResumeDoneEvent{
+		RoomCode:      c.chatroom,
+		Replayed:      len(*messages),
+		LastMessageId: lastId,
+		HasMore:       hasMore,
+	})
+	if err != nil {
+		c.endReplay(lastId)
+		return fmt.Errorf("error marshal payload: %v", err)
+	}
+	c.sendBlocking(Event{Type: EventResumeDone, Payload: data})
+
+	c.endReplay(lastId)
+
+	return nil
+}
+
+func (m *Manager) findMessagesAfter(roomId, afterId, limit int) (*[]models.MessageShow, bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		database.CommitOrRollback(tx, nil, err)
+	}()
+
+	messages, hasMore, err := m.messageRepo.FindByRoom(tx, roomId, 0, afterId, limit)
+	return messages, hasMore, err
+}
+
+func (c *Client) beginReplay() {
+	c.replayLock.Lock()
+	defer c.replayLock.Unlock()
+
+	c.replaying = true
+	c.replayPending = make([]Event, 0, cap(c.egress))
+}
+
+// endReplay send held live event to the client, new_message already replayed (id <= lastReplayedId) is skipped
+func (c *Client) endReplay(lastReplayedId int) {
+	c.replayLock.Lock()
+	defer c.replayLock.Unlock()
+
+	for _, event := range c.replayPending {
+		if event.Type == EventNewMessage {
+			var message NewMessageEvent
+			if err := json.Unmarshal(event.Payload, &message); err == nil && message.Id <= lastReplayedId {
+				continue
+			}
+		}
+
+		c.enqueue(event)
+	}
+
+	c.replaying = false
+	c.replayPending = nil
+}
+
+func newMessageEventFromShow(message *models.MessageShow) NewMessageEvent {
+	newMessage := NewMessageEvent{
+		SendMessageEvent: SendMessageEvent{
+			Message:  message.Content,
+			From:     message.SenderUsername,
+			ParentId: message.ParentId,
+		},
+		Id:          message.Id,
+		SenderId:    message.SenderId,
+		CreatedAt:   message.CreatedAt,
+		EditedAt:    message.EditedAt,
+		Deleted:     message.Deleted,
+		Parent:      message.Parent,
+		ReplyCount:  message.ReplyCount,
+		Attachments: message.Attachments,
+		Sent:        time.Now(),
+	}
+	if sent, err := time.Parse(time.RFC3339Nano, message.CreatedAt); err == nil {
+		newMessage.Sent = sent
+	}
+
+	return newMessage
+}
@@ -0,0 +1,147 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/momokii/simple-chat-app/internal/database"
+	"github.com/momokii/simple-chat-app/internal/models"
+)
+
+// typing indicator and read receipt event handler
+
+var (
+	typingThrottle = 2 * time.Second // min interval typing_start from same client broadcasted to the room
+	typingExpire   = 5 * time.Second // typing automatically stopped when client not send typing_start again in this time
+)
+
+func TypingStartHandler(event Event, c *Client) error {
+	if c.chatroom == "" {
+		return ErrNoRoom
+	}
+
+	if c.isTrainRoom {
+		return errors.New("typing indicator is not available on train room")
+	}
+
+	c.typingLock.Lock()
+	now := time.Now()
+	throttled := c.typingTimer != nil && now.Sub(c.typingLastSent) < typingThrottle
+	if !throttled {
+		c.typingLastSent = now
+	}
+
+	// reset the expire timer every time client still typing
+	if c.typingTimer != nil {
+		c.typingTimer.Stop()
+	}
+	c.typingGen++
+	gen := c.typingGen
+	c.typingRoom = c.chatroom
+	c.typingTimer = time.AfterFunc(typingExpire, func() {
+		c.stopTyping(gen)
+	})
+	roomCode := c.typingRoom
+	c.typingLock.Unlock()
+
+	if throttled {
+		return nil
+	}
+
+	return c.manager.broadcastTyping(EventTypingStart, c, roomCode)
+}
+
+func TypingStopHandler(event Event, c *Client) error {
+	c.stopTyping(0)
+	return nil
+}
+
+// stopTyping stop typing state of client and broadcast typing_stop to the room
+// gen used by expire timer so the old timer will not stop newer typing state, 0 mean stop any typing state
+func (c *Client) stopTyping(gen int) {
+	c.typingLock.Lock()
+	if c.typingTimer == nil || (gen != 0 && gen != c.typingGen) {
+		c.typingLock.Unlock()
+		return
+	}
+	c.typingTimer.Stop()
+	c.typingTimer = nil
+	roomCode := c.typingRoom
+	c.typingLock.Unlock()
+
+	if err := c.manager.broadcastTyping(EventTypingStop, c, roomCode); err != nil {
+		log.Println("error broadcast typing stop: ", err)
+	}
+}
+
+func (m *Manager) broadcastTyping(eventType string, c *Client, roomCode string) error {
+	data, err := json.Marshal(TypingEvent{
+		RoomCode: roomCode,
+		UserId:   c.user.Id,
+		Username: c.user.Username,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshal payload: %v", err)
+	}
+
+	return m.Broadcast(roomCode, Event{Type: eventType, Payload: data})
+}
+
+// MarkReadHandler save the last read message of user in the room and broadcast read receipt to the room
+func MarkReadHandler(event Event, c *Client) error {
+	var markRead MarkReadEvent
+
+	if err := json.Unmarshal(event.Payload, &markRead); err != nil {
+		return fmt.Errorf("error unmarshal payload: %v", err)
+	}
+
+	if c.chatroom == "" {
+		return ErrNoRoom
+	}
+
+	if markRead.MessageId < 1 {
+		return errors.New("message id is required")
+	}
+
+	isUpdated, err := c.manager.saveRoomRead(&models.RoomRead{
+		RoomId:            c.roomId,
+		UserId:            c.user.Id,
+		LastReadMessageId: markRead.MessageId,
+	})
+	if err != nil {
+		log.Println("error save room read: ", err)
+		return errors.New("failed to mark message as read")
+	}
+
+	if !isUpdated {
+		return errors.New("message is not exist in this room")
+	}
+
+	data, err := json.Marshal(ReadReceiptEvent{
+		RoomCode:  c.chatroom,
+		UserId:    c.user.Id,
+		Username:  c.user.Username,
+		MessageId: markRead.MessageId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshal payload: %v", err)
+	}
+
+	return c.manager.Broadcast(c.chatroom, Event{Type: EventReadReceipt, Payload: data})
+}
+
+func (m *Manager) saveRoomRead(roomRead *models.RoomRead) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		database.CommitOrRollback(tx, nil, err)
+	}()
+
+	isUpdated, err := m.roomReadRepo.Upsert(tx, roomRead)
+	return isUpdated, err
+}
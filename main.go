@@ -3,23 +3,38 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/template/html/v2"
-	"github.com/momokii/go-llmbridge/pkg/openai"
 	"github.com/momokii/simple-chat-app/internal/database"
 	"github.com/momokii/simple-chat-app/internal/handlers"
+	"github.com/momokii/simple-chat-app/internal/llm"
 	"github.com/momokii/simple-chat-app/internal/middlewares"
+	"github.com/momokii/simple-chat-app/internal/repository/attachment"
+	"github.com/momokii/simple-chat-app/internal/repository/direct"
+	"github.com/momokii/simple-chat-app/internal/repository/mention"
 	"github.com/momokii/simple-chat-app/internal/repository/message"
+	messagereaction "github.com/momokii/simple-chat-app/internal/repository/message_reaction"
+	pinnedmessage "github.com/momokii/simple-chat-app/internal/repository/pinned_message"
 	"github.com/momokii/simple-chat-app/internal/repository/room"
+	roomban "github.com/momokii/simple-chat-app/internal/repository/room_ban"
+	roominvite "github.com/momokii/simple-chat-app/internal/repository/room_invite"
+	roomjoinrequest "github.com/momokii/simple-chat-app/internal/repository/room_join_request"
 	roommember "github.com/momokii/simple-chat-app/internal/repository/room_member"
+	roomread "github.com/momokii/simple-chat-app/internal/repository/room_read"
 	"github.com/momokii/simple-chat-app/internal/repository/room_train"
+	roomtrainreport "github.com/momokii/simple-chat-app/internal/repository/room_train_report"
 	"github.com/momokii/simple-chat-app/internal/repository/session"
+	trainpersona "github.com/momokii/simple-chat-app/internal/repository/train_persona"
 	"github.com/momokii/simple-chat-app/internal/repository/user"
+	"github.com/momokii/simple-chat-app/internal/storage"
+	"github.com/momokii/simple-chat-app/internal/trainreport"
 	"github.com/momokii/simple-chat-app/internal/ws"
+	"github.com/momokii/simple-chat-app/pkg/utils"
 
 	sso_conn_room_reserved "github.com/momokii/go-sso-web/pkg/repository/conn_room_credit_reserved"
 	sso_user "github.com/momokii/go-sso-web/pkg/repository/user"
@@ -29,17 +44,40 @@ import (
 )
 
 func main() {
-	// llm client init
-	gptClient, err := openai.New(
-		os.Getenv("OA_APIKEY"),
-		os.Getenv("OA_ORGANIZATIONID"),
-		os.Getenv("OA_PROJECTID"),
-		openai.WithModel("gpt-4o-mini"),
-	)
+	// llm client init, openai (default) or openai compatible local endpoint (ollama/llama.cpp)
+	var llmClient llm.Client
+	var err error
+	llmProvider := os.Getenv("LLM_PROVIDER")
+	switch llmProvider {
+	case "", "openai":
+		llmClient, err = llm.NewOpenAI(
+			os.Getenv("OA_APIKEY"),
+			os.Getenv("OA_ORGANIZATIONID"),
+			os.Getenv("OA_PROJECTID"),
+			os.Getenv("LLM_MODEL"),
+		)
+	case "local":
+		llmClient, err = llm.NewLocal(
+			os.Getenv("LLM_BASE_URL"),
+			os.Getenv("LLM_MODEL"),
+			os.Getenv("LLM_APIKEY"),
+		)
+	default:
+		err = llm.ErrProviderNotFound
+	}
 	if err != nil {
-		log.Println("Error when init openai client: ", err)
-	} else {
-		log.Println("OpenAI client is ready")
+		log.Fatal("Error when init llm client: ", err)
+	}
+	log.Println("LLM client is ready")
+
+	// attachment storage init, using local filesystem storage
+	attachmentDir := os.Getenv("ATTACHMENT_DIR")
+	if attachmentDir == "" {
+		attachmentDir = "./uploads"
+	}
+	attachmentStorage, err := storage.NewLocalStorage(attachmentDir)
+	if err != nil {
+		log.Fatal("Error when init attachment storage: ", err)
 	}
 
 	// db and session storage init
@@ -50,25 +88,67 @@ func main() {
 	userRepo := user.NewUserRepo()
 	roomRepo := room.NewRoomChatRepo()
 	roomTrainRepo := room_train.NewRoomChatTrainRepo()
+	roomTrainReportRepo := roomtrainreport.NewRoomTrainReportRepo()
+	trainPersonaRepo := trainpersona.NewTrainPersonaRepo()
 	messageRepo := message.NewMessageRepo()
+	messageReactionRepo := messagereaction.NewMessageReactionRepo()
+	mentionRepo := mention.NewMentionRepo()
+	attachmentRepo := attachment.NewAttachmentRepo()
+	pinnedMessageRepo := pinnedmessage.NewPinnedMessageRepo()
 	roomemberRepo := roommember.NewRoomMember()
+	roomReadRepo := roomread.NewRoomReadRepo()
+	roomBanRepo := roomban.NewRoomBanRepo()
+	roomInviteRepo := roominvite.NewRoomInviteRepo()
+	roomJoinRequestRepo := roomjoinrequest.NewRoomJoinRequestRepo()
+	directRepo := direct.NewDirectRoomRepo()
 	sessionRepo := session.NewSessionRepo()
 	SSOCreditReservedRepo := sso_credit_reserved.NewUserCreditReserved()
 	SSOConnReservedRoomRepo := sso_conn_room_reserved.NewConnRoomCreditReserved()
 	SSOUser := sso_user.NewUserRepo()
 
+	// init websocket manager
+	// use postgres LISTEN/NOTIFY broadcaster when running multiple instance, default is in memory broadcaster
+	var broadcaster ws.Broadcaster
+	if os.Getenv("WS_BROADCASTER") == "postgres" {
+		pgBroadcaster, err := ws.NewPostgresBroadcaster(database.DB, database.ConnString())
+		if err != nil {
+			log.Fatal("Error when init postgres broadcaster: ", err)
+		}
+		defer pgBroadcaster.Close()
+
+		broadcaster = pgBroadcaster
+		log.Println("Websocket using postgres broadcaster")
+	} else {
+		broadcaster = ws.NewLocalBroadcaster()
+	}
+	egressBufferSize, _ := strconv.Atoi(os.Getenv("WS_EGRESS_BUFFER_SIZE"))
+	manager := ws.NewManager(ws.ManagerConfig{
+		Broadcaster:      broadcaster,
+		EgressBufferSize: egressBufferSize,
+		SlowClientPolicy: ws.SlowClientPolicy(os.Getenv("WS_SLOW_CLIENT_POLICY")),
+	}, *roomRepo, *roomemberRepo, *messageRepo, *roomReadRepo, *roomBanRepo, *mentionRepo, *attachmentRepo)
+
+	// coaching report generator, shared by train message and train report handler
+	reportGenerator := trainreport.NewGenerator(*roomTrainRepo, *messageRepo, *roomTrainReportRepo, llmClient, manager)
+
 	// handler init
 	authHandler := handlers.NewAuthHandler(*userRepo, *sessionRepo)
-	roomHandler := handlers.NewRoomChatHandler(*roomRepo, *roomTrainRepo, *roomemberRepo, gptClient, *SSOUser, *SSOCreditReservedRepo, *SSOConnReservedRoomRepo)
+	roomHandler := handlers.NewRoomChatHandler(*roomRepo, *roomTrainRepo, *roomTrainReportRepo, reportGenerator, *roomemberRepo, *roomBanRepo, *roomInviteRepo, *roomJoinRequestRepo, llmClient, *SSOUser, *SSOCreditReservedRepo, *SSOConnReservedRoomRepo, *attachmentRepo, *pinnedMessageRepo, *trainPersonaRepo, attachmentStorage, manager)
 	userHandler := handlers.NewUserHandler(*userRepo)
-	messageHandler := handlers.NewMessageHandler(*roomRepo, *messageRepo, gptClient, *roomTrainRepo, *SSOCreditReservedRepo)
+	attachmentHandler := handlers.NewAttachmentHandler(*roomRepo, *roomemberRepo, *messageRepo, *attachmentRepo, attachmentStorage)
+	mentionHandler := handlers.NewMentionHandler(*mentionRepo)
+	personaHandler := handlers.NewPersonaHandler(*trainPersonaRepo)
+	directHandler := handlers.NewDirectHandler(*roomRepo, *roomemberRepo, *directRepo, *userRepo)
+	messageHandler := handlers.NewMessageHandler(*roomRepo, *messageRepo, llmClient, *roomTrainRepo, *roomemberRepo, *messageReactionRepo, *mentionRepo, *attachmentRepo, *pinnedMessageRepo, attachmentStorage, *SSOCreditReservedRepo, reportGenerator, manager)
 
-	// init websocket manager
-	manager := ws.NewManager()
+	// uploaded attachment that never sent is deleted periodically so the storage not filled by abandoned upload
+	attachmentHandler.StartUnsentCleanup(utils.ATTACHMENT_UNSENT_CLEANUP_INTERVAL, utils.ATTACHMENT_UNSENT_MAX_AGE)
 
 	engine := html.New("./web", ".html")
 	app := fiber.New(fiber.Config{
 		Views: engine,
+		// body limit follow the max attachment size, with extra space for multipart form data
+		BodyLimit: int(utils.AttachmentMaxSize()) + 1024*1024,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -107,9 +187,17 @@ func main() {
 	// room page
 	app.Get("/rooms/:room_code/train", middlewares.IsAuth, roomHandler.RoomTrainChatView)
 	api.Get("/rooms/:room_code/train/detail", middlewares.IsAuth, roomHandler.GetTrainRoomData)
+	api.Get("/rooms/:room_code/train/report", middlewares.IsAuth, roomHandler.GetTrainReport)
+	api.Post("/rooms/:room_code/train/report", middlewares.IsAuth, roomHandler.CreateTrainReport)
 	app.Get("/rooms/:room_code", middlewares.IsAuth, roomHandler.RoomChatView)
+	api.Get("/rooms/join-requests", middlewares.IsAuth, roomHandler.GetUserJoinRequestList)
+	api.Get("/rooms/:room_code/online", middlewares.IsAuth, roomHandler.GetRoomOnlineUsers)
+	api.Get("/rooms/:room_code/bans", middlewares.IsAuth, roomHandler.GetRoomBanList)
+	api.Get("/rooms/:room_code/invites", middlewares.IsAuth, roomHandler.GetRoomInviteList)
+	api.Get("/rooms/:room_code/join-requests", middlewares.IsAuth, roomHandler.GetRoomJoinRequestList)
 	api.Get("/rooms/:room_code", middlewares.IsAuth, roomHandler.GetRoomData)
 	api.Get("/rooms", middlewares.IsAuth, roomHandler.GetRoomList)
+	api.Post("/rooms/train/persona", middlewares.IsAuth, roomHandler.GenerateTrainPersona)
 	api.Post("/rooms/train", middlewares.IsAuth, roomHandler.CreateTrainRoom)
 	api.Post("/rooms", middlewares.IsAuth, roomHandler.CreateRoom)
 	api.Patch("/rooms", middlewares.IsAuth, roomHandler.EditRoom)
@@ -117,12 +205,44 @@ func main() {
 
 	api.Post("/rooms/members", middlewares.IsAuth, roomHandler.AddJoinRoom)
 	api.Delete("/rooms/members", middlewares.IsAuth, roomHandler.RemoveRoomMember)
+	api.Patch("/rooms/members/role", middlewares.IsAuth, roomHandler.UpdateRoomMemberRole)
+	api.Post("/rooms/members/kick", middlewares.IsAuth, roomHandler.KickRoomMember)
+	api.Post("/rooms/members/ban", middlewares.IsAuth, roomHandler.BanRoomMember)
+	api.Delete("/rooms/members/ban", middlewares.IsAuth, roomHandler.UnbanRoomMember)
+	api.Post("/rooms/invites", middlewares.IsAuth, roomHandler.CreateRoomInvite)
+	api.Delete("/rooms/invites", middlewares.IsAuth, roomHandler.RevokeRoomInvite)
+	api.Post("/rooms/invites/redeem", middlewares.IsAuth, roomHandler.RedeemRoomInvite)
+	api.Post("/rooms/join-requests", middlewares.IsAuth, roomHandler.CreateJoinRequest)
+	api.Patch("/rooms/join-requests", middlewares.IsAuth, roomHandler.ReviewJoinRequest)
 
-	app.Get("/ws/:room_code", adaptor.HTTPHandlerFunc(manager.ServeWS)) // websocket connection
+	app.Get("/ws", middlewares.IsWSAuth, adaptor.HTTPHandlerFunc(manager.ServeWS))
+	app.Get("/ws/:room_code", middlewares.IsWSAuth, adaptor.HTTPHandlerFunc(manager.ServeWS)) // websocket connection
+	api.Get("/messages/search", middlewares.IsAuth, messageHandler.SearchMessage)
+	api.Get("/messages/:room_code/threads/:message_id", middlewares.IsAuth, messageHandler.GetMessageThread)
 	api.Get("/messages/:room_code", middlewares.IsAuth, messageHandler.GetMessageByRoom)
-	api.Post("/messages/train/save", middlewares.IsAuth, messageHandler.SaveMessageLLM)
 	api.Post("/messages/train", middlewares.IsAuth, messageHandler.SendMessageTrain)
+	api.Post("/messages/reactions", middlewares.IsAuth, messageHandler.AddReaction)
+	api.Delete("/messages/reactions", middlewares.IsAuth, messageHandler.RemoveReaction)
+	api.Post("/messages/pins", middlewares.IsAuth, messageHandler.PinMessage)
+	api.Delete("/messages/pins", middlewares.IsAuth, messageHandler.UnpinMessage)
 	api.Post("/messages", middlewares.IsAuth, messageHandler.SaveNewMessage)
+	api.Patch("/messages", middlewares.IsAuth, messageHandler.EditMessage)
+	api.Delete("/messages", middlewares.IsAuth, messageHandler.DeleteMessage)
+
+	api.Get("/directs", middlewares.IsAuth, directHandler.GetDirectList)
+	api.Post("/directs", middlewares.IsAuth, directHandler.OpenDirect)
+
+	api.Post("/attachments", middlewares.IsAuth, attachmentHandler.UploadAttachment)
+	api.Get("/attachments/:id/thumbnail", middlewares.IsAuth, attachmentHandler.GetAttachmentThumbnail)
+	api.Get("/attachments/:id", middlewares.IsAuth, attachmentHandler.GetAttachment)
+
+	api.Get("/personas", middlewares.IsAuth, personaHandler.GetPersonaList)
+	api.Post("/personas", middlewares.IsAuth, personaHandler.CreatePersona)
+	api.Patch("/personas", middlewares.IsAuth, personaHandler.EditPersona)
+	api.Delete("/personas", middlewares.IsAuth, personaHandler.DeletePersona)
+
+	api.Get("/mentions", middlewares.IsAuth, mentionHandler.GetMentionInbox)
+	api.Patch("/mentions/read", middlewares.IsAuth, mentionHandler.MarkMentionRead)
 
 	api.Patch("/users", middlewares.IsAuth, userHandler.ChangeUsername)
 	api.Patch("/users/password", middlewares.IsAuth, userHandler.ChangePassword)
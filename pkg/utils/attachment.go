@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// default max attachment size in bytes
+	DEFAULT_ATTACHMENT_MAX_SIZE = 5 * 1024 * 1024
+
+	// thumbnail longest side in pixel
+	THUMBNAIL_MAX_SIZE = 320
+
+	// max image dimension to decode for thumbnail, to avoid decompression bomb
+	THUMBNAIL_MAX_SOURCE_PIXEL = 40_000_000
+
+	// uploaded attachment that not sent with any message after this age is deleted, and how often the cleanup run
+	ATTACHMENT_UNSENT_MAX_AGE          = 24 * time.Hour
+	ATTACHMENT_UNSENT_CLEANUP_INTERVAL = time.Hour
+)
+
+// allowed attachment mime type (detected from file content), value is true if the type is image
+// only image type that can be decoded by standard library allowed as image, so every image have thumbnail
+var AttachmentMimeTypes = map[string]bool{
+	"image/jpeg":         true,
+	"image/png":          true,
+	"image/gif":          true,
+	"application/pdf":    false,
+	"application/zip":    false,
+	"text/plain":         false,
+	"audio/mpeg":         false,
+	"video/mp4":          false,
+	"application/x-gzip": false,
+}
+
+// AttachmentMaxSize get max attachment size in bytes from env ATTACHMENT_MAX_SIZE, using default value if not set or invalid
+func AttachmentMaxSize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_SIZE"), 10, 64)
+	if err != nil || size < 1 {
+		return DEFAULT_ATTACHMENT_MAX_SIZE
+	}
+
+	return size
+}
+
+// GenerateThumbnail decode the image (jpeg, png and gif) and scale it down to fit THUMBNAIL_MAX_SIZE, encoded as jpeg
+// transparent area filled with white because jpeg not support transparency
+func GenerateThumbnail(r io.ReadSeeker) ([]byte, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width*config.Height > THUMBNAIL_MAX_SOURCE_PIXEL {
+		return nil, image.ErrFormat
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > THUMBNAIL_MAX_SIZE || height > THUMBNAIL_MAX_SIZE {
+		if width >= height {
+			height = max(height*THUMBNAIL_MAX_SIZE/width, 1)
+			width = THUMBNAIL_MAX_SIZE
+		} else {
+			width = max(width*THUMBNAIL_MAX_SIZE/height, 1)
+			height = THUMBNAIL_MAX_SIZE
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	// box sampling, every destination pixel is the average of the covered source pixel
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+
+			var red, green, blue, alpha, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					red += uint64(cr)
+					green += uint64(cg)
+					blue += uint64(cb)
+					alpha += uint64(ca)
+					count++
+				}
+			}
+
+			// blend premultiplied color over white background
+			a := alpha / count
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(red/count + 0xffff - a),
+				G: uint16(green/count + 0xffff - a),
+				B: uint16(blue/count + 0xffff - a),
+				A: 0xffff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
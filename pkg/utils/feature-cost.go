@@ -2,4 +2,6 @@ package utils
 
 const (
 	FEATURE_DATING_CHAT_SIMULATION_COST = 10
+	// every generated persona preview charged, so the LLM can't be called repeatedly for free
+	FEATURE_DATING_PERSONA_PREVIEW_COST = 1
 )
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// default time window (in seconds) for sender to edit their message
+	DEFAULT_MESSAGE_EDIT_WINDOW = 15 * 60
+
+	// max rune on single emoji, emoji with skin tone or zwj sequence (e.g. family emoji) can have many rune
+	MAX_EMOJI_RUNE = 10
+)
+
+// MessageEditWindow get edit window (in seconds) from env MESSAGE_EDIT_WINDOW, using default value if not set or invalid
+func MessageEditWindow() int {
+	window, err := strconv.Atoi(os.Getenv("MESSAGE_EDIT_WINDOW"))
+	if err != nil || window < 1 {
+		return DEFAULT_MESSAGE_EDIT_WINDOW
+	}
+
+	return window
+}
+
+// IsEmoji check the string is a single emoji (include skin tone, keycap, flag and zwj sequence), used for message reaction
+func IsEmoji(s string) bool {
+	count := utf8.RuneCountInString(s)
+	if count == 0 || count > MAX_EMOJI_RUNE {
+		return false
+	}
+
+	hasSymbol := false
+	for i, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r):
+			hasSymbol = true
+		case r == 0x200D, // zero width joiner
+			r == 0xFE0E, r == 0xFE0F, // variation selector
+			r >= 0x1F3FB && r <= 0x1F3FF, // skin tone modifier
+			r >= 0xE0020 && r <= 0xE007F: // tag sequence (e.g. subdivision flag)
+		case r == 0x20E3: // combining keycap
+			hasSymbol = true
+		case i == 0 && (r == '#' || r == '*' || (r >= '0' && r <= '9')):
+			// keycap base, must be followed by keycap
+		default:
+			return false
+		}
+	}
+
+	return hasSymbol
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// phrase usually used to override the system prompt, matched as whole word sequence so normal word containing it (e.g. "pemerintahan") still allowed
+// persona text also placed as quoted data on delimited block of the system prompt, so this only reject the obvious attempt
+var personaBlockedPhrases = [][]string{
+	{"ignore", "previous"}, {"ignore", "all"}, {"ignore", "above"}, {"ignore", "the", "above"}, {"disregard", "previous"}, {"disregard", "all"},
+	{"forget", "previous"}, {"previous", "instructions"}, {"new", "instructions"}, {"system", "prompt"}, {"jailbreak"}, {"developer", "mode"}, {"you", "are", "now"},
+	{"abaikan", "instruksi"}, {"abaikan", "perintah"}, {"abaikan", "semua"}, {"lupakan", "instruksi"}, {"lupakan", "perintah"},
+	{"instruksi", "sebelumnya"}, {"perintah", "sebelumnya"}, {"prompt", "sistem"}, {"kamu", "sekarang", "adalah"},
+}
+
+// IsSafePersonaText check persona text can be placed on LLM prompt, the text must be single line without markup or instruction phrase
+func IsSafePersonaText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return false
+		}
+
+		switch r {
+		case '`', '<', '>', '{', '}', '[', ']':
+			return false
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, phrase := range personaBlockedPhrases {
+		if containsPhrase(words, phrase) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsPhrase check the phrase words appear consecutively on the words
+func containsPhrase(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		matched := true
+		for j, word := range phrase {
+			if words[i+j] != word {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SanitizePersonaText make the LLM generated persona text single line and cut it to max rune, so it still valid when saved as persona
+func SanitizePersonaText(s string, max int) string {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '`', '<', '>', '{', '}', '[', ']':
+			return -1
+		}
+		return r
+	}, s)
+
+	if utf8.RuneCountInString(s) > max {
+		s = strings.TrimSpace(string([]rune(s)[:max]))
+	}
+
+	return s
+}
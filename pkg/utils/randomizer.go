@@ -1,6 +1,8 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"encoding/base64"
 	"math/rand"
 )
 
@@ -12,3 +14,12 @@ func RandomString(n int) string {
 	}
 	return string(b)
 }
+
+// SecureRandomString generate url safe random string from crypto/rand, used for secret token (e.g. invite token)
+func SecureRandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b)[:n], nil
+}
@@ -14,6 +14,11 @@ var (
 func GetValidator() *validator.Validate {
 	once.Do(func() {
 		validate = validator.New(validator.WithRequiredStructEnabled())
+
+		// persona_text used on persona field that placed on LLM prompt
+		validate.RegisterValidation("persona_text", func(fl validator.FieldLevel) bool {
+			return IsSafePersonaText(fl.Field().String())
+		})
 	})
 
 	return validate